@@ -0,0 +1,120 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// ErrInvalidAutoBackground is returned when the tolerance is negative or the min confidence is not in [0,1]
+var ErrInvalidAutoBackground = errors.New("auto background tolerance must not be negative and min confidence must be between 0 and 1")
+
+// AutoBackground estimates the background color from the border ring of the image, so any uniform backdrop
+// (grey, beige, blue seamless paper etc.) can be removed without defining a ColorBackgroundMask for it.
+// The background color is the dominant color of the border: the border pixel with the most border pixels within
+// Tolerance of it, averaged with those pixels. With a gradient Model the background color varies over the image instead,
+// and is fitted to the border pixels
+type AutoBackground struct {
+	// Tolerance is the max distance in Lab (CIE76 ΔE) from the background color, for border pixels to count as
+	// background and for pixels to be removed. 0 disables the estimation
+	Tolerance float64
+	// MinConfidence is the fraction (0-1) of the border that must be within Tolerance for the background to be removed
+	MinConfidence float64
+	// Model is how the background color may vary over the image, e.g. a gradient or vignette (default ModelUniform)
+	Model BackgroundModel
+}
+
+// enabled returns true if the background should be estimated
+func (a AutoBackground) enabled() bool {
+	return a.Tolerance > 0
+}
+
+// validate checks that the values are in range
+func (a AutoBackground) validate() error {
+	if a.Tolerance < 0 || a.MinConfidence < 0 || a.MinConfidence > 1 {
+		return ErrInvalidAutoBackground
+	}
+	switch a.Model {
+	case ModelUniform, ModelPlanar, ModelRadial:
+		return nil
+	}
+	return ErrInvalidMethod
+}
+
+// estimateBackground finds the dominant color of the border, or fits the gradient model to it,
+// the pixels within tolerance of it are the seeds for the removal
+func estimateBackground(opts *Options, imgDraw *draw.Image) background {
+	var bg background
+
+	rect := (*imgDraw).Bounds()
+	var border []image.Point
+	for _, p := range borderPixels(rect) {
+		if !isPixelTransparent(p.X, p.Y, imgDraw) {
+			border = append(border, p)
+		}
+	}
+	if len(border) == 0 {
+		return bg
+	}
+
+	labs := make([][3]float64, len(border))
+	for i, p := range border {
+		labs[i] = pixelLab(imgDraw, p.X, p.Y)
+	}
+
+	tolerance := opts.AutoBackground.Tolerance
+	if opts.AutoBackground.Model != ModelUniform {
+		bg.model, bg.seeds = fitModel(opts.AutoBackground.Model, rect, border, labs, tolerance)
+	}
+	if bg.model == nil {
+		bg.model, bg.seeds = dominantColor(imgDraw, rect, border, labs, tolerance)
+	}
+
+	bg.confidence = float64(len(bg.seeds)) / float64(len(border))
+	bg.borderMatch = bg.confidence
+	bg.remove = bg.confidence > 0 && bg.confidence >= opts.AutoBackground.MinConfidence
+
+	// for a gradient this is the color at the center
+	lab := bg.model.at(image.Point{X: (rect.Min.X + rect.Max.X) / 2, Y: (rect.Min.Y + rect.Max.Y) / 2})
+	c := fromDeltaELab(lab).Clamped()
+	colorItem := newColorItem(to16Bit(c.R), to16Bit(c.G), to16Bit(c.B), len(bg.seeds), float64(len(bg.seeds)))
+	bg.color = &colorItem
+
+	return bg
+}
+
+// dominantColor returns a uniform model of the dominant color of the border, and the border pixels within tolerance of it
+func dominantColor(imgDraw *draw.Image, rect image.Rectangle, border []image.Point, labs [][3]float64, tolerance float64) (*bgModel, []image.Point) {
+	best, bestCnt := 0, 0
+	for i := range labs {
+		cnt := 0
+		for j := range labs {
+			if euclidean(labs[i], labs[j]) <= tolerance {
+				cnt++
+			}
+		}
+		if cnt > bestCnt {
+			best, bestCnt = i, cnt
+		}
+	}
+
+	// average the pixels close to the most common color, and count how many are close to the average
+	var near []image.Point
+	for i, p := range border {
+		if euclidean(labs[best], labs[i]) <= tolerance {
+			near = append(near, p)
+		}
+	}
+	bgLab, _ := meanLab(imgDraw, near)
+	var seeds []image.Point
+	for i, p := range border {
+		if euclidean(bgLab, labs[i]) <= tolerance {
+			seeds = append(seeds, p)
+		}
+	}
+	return newUniformModel(rect, bgLab), seeds
+}
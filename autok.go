@@ -0,0 +1,271 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"math"
+	"time"
+)
+
+// KCriterion defines how AutoK picks the best K
+type KCriterion int
+
+const (
+	// CriterionSilhouette picks the K with the highest silhouette score
+	CriterionSilhouette KCriterion = iota
+	// CriterionElbow picks the K where the inertia curve bends the most (the "elbow")
+	CriterionElbow
+	// CriterionDaviesBouldin picks the K with the lowest Davies-Bouldin index
+	CriterionDaviesBouldin
+)
+
+// silhouetteSampleSize is the max number of unique colors the silhouette score is calculated for,
+// since it is quadratic in the number of colors
+const silhouetteSampleSize = 1000
+
+// ErrInvalidKRange is returned by AutoK when the range of K is not usable with the criterion
+var ErrInvalidKRange = errors.New("invalid range of k")
+
+// KScore contains the score of the clustering for one K
+type KScore struct {
+	K int
+	// Score is the silhouette score, the distance to the elbow line or the Davies-Bouldin index, depending on the criterion
+	Score float64
+	// Inertia is the sum of squared distances from each pixel to its centroid
+	Inertia float64
+}
+
+// AutoKResult is the Result for the K that was picked, together with the scores for all K that were tried
+type AutoKResult struct {
+	*Result
+	// K is the K that was picked
+	K      int
+	Scores []KScore
+}
+
+// AutoK runs the clustering for each K in [minK, maxK] and picks the best one according to criterion.
+// The image is only cropped, resized and masked once, K in opts is ignored.
+// Silhouette and Davies-Bouldin need at least two clusters, so minK must be at least 2 for them.
+func AutoK(orgimg image.Image, minK, maxK int, criterion KCriterion, opts ...Option) (*AutoKResult, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if criterion != CriterionSilhouette && criterion != CriterionElbow && criterion != CriterionDaviesBouldin {
+		return nil, &OptionError{Option: "criterion", Err: ErrInvalidMethod}
+	}
+
+	if minK < 1 || maxK < minK || (criterion != CriterionElbow && minK < 2) {
+		return nil, &OptionError{Option: "minK/maxK", Err: ErrInvalidKRange}
+	}
+
+	res := &Result{}
+
+	img, err := prepareImg(o, orgimg, res)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	allColors, numPixels := extractColorsAsArray(o, img)
+	res.PixelsConsidered = numPixels
+
+	if len(allColors) == 0 {
+		return nil, ErrNoPixelsFound
+	}
+
+	// no point in trying more clusters than there are colors
+	if maxK > len(allColors) {
+		maxK = len(allColors)
+	}
+	if minK > maxK {
+		minK = maxK
+	}
+
+	var clusterings []*clustering
+	var scores []KScore
+	for k := minK; k <= maxK; k++ {
+		ko := *o
+		ko.K = k
+		cl, err := cluster(&ko, img, allColors)
+		if err != nil {
+			return nil, err
+		}
+
+		score := 0.0
+		switch criterion {
+		case CriterionSilhouette:
+			score = silhouette(o, cl)
+		case CriterionDaviesBouldin:
+			score = daviesBouldin(o, cl)
+		}
+
+		clusterings = append(clusterings, cl)
+		scores = append(scores, KScore{K: k, Score: score, Inertia: cl.inertia(o)})
+	}
+
+	if criterion == CriterionElbow {
+		elbowScores(scores)
+	}
+
+	best := 0
+	for i := 1; i < len(scores); i++ {
+		if criterion == CriterionDaviesBouldin {
+			if scores[i].Score < scores[best].Score {
+				best = i
+			}
+		} else if scores[i].Score > scores[best].Score {
+			best = i
+		}
+	}
+
+	res.Timings.Cluster = time.Since(start)
+	res.setClustering(o, clusterings[best])
+
+	return &AutoKResult{Result: res, K: scores[best].K, Scores: scores}, nil
+}
+
+// silhouette calculates the mean silhouette score, weighted by the (alpha and spatially weighted) pixels of each color,
+// the same weights as the clustering uses. Pixels of the same color are at distance 0 from each other
+func silhouette(opts *Options, cl *clustering) float64 {
+	if len(cl.clusters) < 2 {
+		return 0.0
+	}
+
+	weights := make([]float64, len(cl.clusters))
+	for i, colors := range cl.clusters {
+		for _, aPoint := range colors {
+			weights[i] += aPoint.item.Weight
+		}
+	}
+
+	numColors := 0
+	for _, colors := range cl.clusters {
+		numColors += len(colors)
+	}
+	step := 1
+	if numColors > silhouetteSampleSize {
+		step = numColors / silhouetteSampleSize
+	}
+
+	total, totalWeight := 0.0, 0.0
+	idx := 0
+	for ci, colors := range cl.clusters {
+		for _, aPoint := range colors {
+			idx++
+			if idx%step != 0 {
+				continue
+			}
+
+			// weight of own cluster, not counting this pixel (one of the Cnt pixels of the color)
+			own := weights[ci] - aPoint.item.Weight/float64(aPoint.item.Cnt)
+			s := 0.0
+			if own > 0 {
+				a := 0.0
+				b := math.Inf(1)
+				for cj, others := range cl.clusters {
+					if cj != ci && weights[cj] == 0 {
+						continue
+					}
+					sum := 0.0
+					for _, other := range others {
+						sum += other.item.Weight * distance(opts, aPoint, other)
+					}
+					if cj == ci {
+						a = sum / own
+					} else if avg := sum / weights[cj]; avg < b {
+						b = avg
+					}
+				}
+				if max := math.Max(a, b); max > 0 && !math.IsInf(b, 1) {
+					s = (b - a) / max
+				}
+			}
+
+			total += aPoint.item.Weight * s
+			totalWeight += aPoint.item.Weight
+		}
+	}
+
+	if totalWeight == 0 {
+		return 0.0
+	}
+	return total / totalWeight
+}
+
+// daviesBouldin calculates the Davies-Bouldin index, lower is better
+func daviesBouldin(opts *Options, cl *clustering) float64 {
+	// scatter is the mean distance from the pixels of the cluster to its centroid
+	scatter := make([]float64, len(cl.clusters))
+	nonEmpty := make([]bool, len(cl.clusters))
+	for i, colors := range cl.clusters {
+		sum, weight := 0.0, 0.0
+		for _, aPoint := range colors {
+			sum += aPoint.item.Weight * distance(opts, aPoint, cl.centroids[i])
+			weight += aPoint.item.Weight
+		}
+		if weight > 0 {
+			scatter[i] = sum / weight
+			nonEmpty[i] = true
+		}
+	}
+
+	total := 0.0
+	numClusters := 0
+	for i := range cl.clusters {
+		if !nonEmpty[i] {
+			continue
+		}
+		worst := 0.0
+		for j := range cl.clusters {
+			if i == j || !nonEmpty[j] {
+				continue
+			}
+			separation := distance(opts, cl.centroids[i], cl.centroids[j])
+			if separation == 0 {
+				continue
+			}
+			if r := (scatter[i] + scatter[j]) / separation; r > worst {
+				worst = r
+			}
+		}
+		total += worst
+		numClusters++
+	}
+
+	if numClusters == 0 {
+		return 0.0
+	}
+	return total / float64(numClusters)
+}
+
+// elbowScores sets the score of each K to how far below the line between the first and last inertia it is,
+// after normalizing both K and inertia to [0,1], the elbow is where this is largest
+func elbowScores(scores []KScore) {
+	n := len(scores)
+	if n < 3 {
+		return
+	}
+
+	minInertia, maxInertia := scores[0].Inertia, scores[0].Inertia
+	for _, s := range scores {
+		minInertia = math.Min(minInertia, s.Inertia)
+		maxInertia = math.Max(maxInertia, s.Inertia)
+	}
+	if maxInertia == minInertia {
+		return
+	}
+
+	first := (scores[0].Inertia - minInertia) / (maxInertia - minInertia)
+	last := (scores[n-1].Inertia - minInertia) / (maxInertia - minInertia)
+	for i := range scores {
+		x := float64(i) / float64(n-1)
+		y := (scores[i].Inertia - minInertia) / (maxInertia - minInertia)
+		scores[i].Score = first + (last-first)*x - y
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestAutoKSilhouetteFlatColors(t *testing.T) {
+	// three flat, well separated colors, each pixel is at distance 0 from its own cluster
+	img := image.NewRGBA(image.Rect(0, 0, 60, 60))
+	draw.Draw(img, image.Rect(0, 0, 20, 60), image.NewUniform(color.RGBA{220, 30, 30, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 0, 40, 60), image.NewUniform(color.RGBA{30, 200, 40, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(40, 0, 60, 60), image.NewUniform(color.RGBA{30, 40, 220, 255}), image.Point{}, draw.Src)
+
+	res, err := AutoK(img, 2, 4, CriterionSilhouette, WithCropping(false), WithMasks(nil), WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.K != 3 {
+		t.Errorf("got K %d, want 3, scores %v", res.K, res.Scores)
+	}
+	for _, score := range res.Scores {
+		if score.K == 3 && score.Score < 0.99 {
+			t.Errorf("silhouette for K 3 is %v, want close to 1", score.Score)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// DetectMode defines how it is decided if the image has a background matching a mask
+type DetectMode int
+
+const (
+	// DetectCorners applies a mask if all four corners match it (default)
+	DetectCorners DetectMode = iota
+	// DetectBorder applies a mask if at least MinBorderMatch of the border pixels match it,
+	// so e.g. a watermark or shadow in one corner does not stop the background from being removed
+	DetectBorder
+)
+
+// DefaultBorderMatch is the fraction of the border that must match with DetectBorder, a majority
+const DefaultBorderMatch = 0.5
+
+// ErrInvalidBorderMatch is returned when the fraction of the border that must match is not in (0,1]
+var ErrInvalidBorderMatch = errors.New("border match must be larger than 0 and at most 1")
+
+// BackgroundDetection defines how the background is detected
+type BackgroundDetection struct {
+	Mode DetectMode
+	// MinBorderMatch is the fraction (0-1] of the border pixels that must match the mask (DetectBorder)
+	MinBorderMatch float64
+}
+
+// validate checks that the mode is known and the fraction is in range
+func (d BackgroundDetection) validate() error {
+	switch d.Mode {
+	case DetectCorners:
+		return nil
+	case DetectBorder:
+		if d.MinBorderMatch <= 0 || d.MinBorderMatch > 1 {
+			return ErrInvalidBorderMatch
+		}
+		return nil
+	}
+	return ErrInvalidMethod
+}
+
+// background is the outcome of the background detection and removal
+type background struct {
+	// mask is the mask that was applied, nil if none
+	mask *ColorBackgroundMask
+	// seeds are the pixels the removal starts from
+	seeds []image.Point
+	// borderMatch is the fraction of the border that matched mask, or the best mask if none was applied
+	borderMatch float64
+	// numMasked is the number of pixels that were marked transparent
+	numMasked int
+
+	// color is set when the background color was estimated (AutoBackground), model is the background color
+	// over the image and confidence is the fraction of the border within tolerance of it
+	model      *bgModel
+	color      *ColorItem
+	confidence float64
+	// remove is set if the estimated background should be removed
+	remove bool
+}
+
+// corners returns the four corners of rect
+func corners(rect image.Rectangle) []image.Point {
+	return []image.Point{
+		{X: rect.Min.X, Y: rect.Min.Y},
+		{X: rect.Min.X, Y: rect.Max.Y - 1},
+		{X: rect.Max.X - 1, Y: rect.Min.Y},
+		{X: rect.Max.X - 1, Y: rect.Max.Y - 1},
+	}
+}
+
+// borderPixels returns all pixels on the outermost ring of rect, each once
+func borderPixels(rect image.Rectangle) []image.Point {
+	if rect.Empty() {
+		return nil
+	}
+	var points []image.Point
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		points = append(points, image.Point{X: x, Y: rect.Min.Y})
+		if rect.Dy() > 1 {
+			points = append(points, image.Point{X: x, Y: rect.Max.Y - 1})
+		}
+	}
+	for y := rect.Min.Y + 1; y < rect.Max.Y-1; y++ {
+		points = append(points, image.Point{X: rect.Min.X, Y: y})
+		if rect.Dx() > 1 {
+			points = append(points, image.Point{X: rect.Max.X - 1, Y: y})
+		}
+	}
+	return points
+}
+
+// matchingPixels returns the points that match the mask
+func matchingPixels(points []image.Point, bgmask ColorBackgroundMask, imgDraw *draw.Image) []image.Point {
+	var matching []image.Point
+	for _, p := range points {
+		if ignorePixel(p.X, p.Y, bgmask, imgDraw) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+// detectBackground finds the mask to apply according to opts.Background, when several masks match the last one is used
+func detectBackground(opts *Options, imgDraw *draw.Image) background {
+	var bg background
+	rect := (*imgDraw).Bounds()
+	border := borderPixels(rect)
+	if len(border) == 0 {
+		return bg
+	}
+
+	for i := range opts.Masks {
+		bgmask := opts.Masks[i]
+		matching := matchingPixels(border, bgmask, imgDraw)
+		fraction := float64(len(matching)) / float64(len(border))
+
+		var applies bool
+		var seeds []image.Point
+		if opts.Background.Mode == DetectBorder {
+			// the best matching mask is used
+			applies = fraction >= opts.Background.MinBorderMatch && (bg.mask == nil || fraction >= bg.borderMatch)
+			seeds = matching
+		} else {
+			// Check the corners, if not all of them are the color of the mask,
+			// we conclude it's not a solid background and do nothing special
+			seeds = corners(rect)
+			applies = len(matchingPixels(seeds, bgmask, imgDraw)) == len(seeds)
+		}
+
+		if applies {
+			bg.mask = &opts.Masks[i]
+			bg.seeds = seeds
+			bg.borderMatch = fraction
+		} else if bg.mask == nil && fraction > bg.borderMatch {
+			bg.borderMatch = fraction
+		}
+	}
+
+	if bg.mask != nil {
+		// do not point into the options
+		bgmask := *bg.mask
+		bg.mask = &bgmask
+	}
+	return bg
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"math"
+
+	"github.com/oliamb/cutter"
+)
+
+// CropMode defines how the region of the image that is used is picked
+type CropMode int
+
+const (
+	// CropWindow keeps a window of Width x Height (fractions of the image) placed at Anchor (default)
+	CropWindow CropMode = iota
+	// CropSides removes the fractions Left, Top, Right and Bottom of the image from each side
+	CropSides
+	// CropRect keeps the region Rect, in the coordinates of the image
+	CropRect
+	// CropAspect keeps the largest window with the aspect ratio AspectRatio (width/height),
+	// scaled by Scale, placed at Anchor
+	CropAspect
+	// CropSalient keeps the window of Width x Height (fractions of the image) with the highest saliency,
+	// i.e. where edges, color contrast and saturation are concentrated
+	CropSalient
+)
+
+// CropAnchor defines where a window is placed in the image, the window is centered on the anchor
+// as far as possible without going outside the image
+type CropAnchor int
+
+const (
+	// AnchorCenter centers the window in the image
+	AnchorCenter CropAnchor = iota
+	// AnchorTop places the window at the top, centered horizontally
+	AnchorTop
+	// AnchorBottom places the window at the bottom, centered horizontally
+	AnchorBottom
+	// AnchorLeft places the window at the left side, centered vertically
+	AnchorLeft
+	// AnchorRight places the window at the right side, centered vertically
+	AnchorRight
+	// AnchorUpperThird centers the window on the upper horizontal third line
+	AnchorUpperThird
+	// AnchorLowerThird centers the window on the lower horizontal third line
+	AnchorLowerThird
+	// AnchorLeftThird centers the window on the left vertical third line
+	AnchorLeftThird
+	// AnchorRightThird centers the window on the right vertical third line
+	AnchorRightThird
+)
+
+// ErrInvalidCrop is returned when the crop settings are out of range or select an empty region
+var ErrInvalidCrop = errors.New("invalid crop")
+
+// Crop defines the region of the image that is used, which fields are used depends on Mode
+type Crop struct {
+	Mode CropMode
+
+	// Width and Height of the window, as fractions (0-1] of the image (CropWindow and CropSalient)
+	Width, Height float64
+
+	// Left, Top, Right and Bottom are the fractions [0-1) of the image removed from each side (CropSides)
+	Left, Top, Right, Bottom float64
+
+	// Rect is the region to keep (CropRect)
+	Rect image.Rectangle
+
+	// AspectRatio is width/height of the window (CropAspect)
+	AspectRatio float64
+	// Scale of the window compared to the largest window that fits, (0-1] (CropAspect)
+	Scale float64
+
+	// Anchor is where the window is placed (CropWindow and CropAspect)
+	Anchor CropAnchor
+}
+
+// DefaultCrop keeps the center of the image, removing 25% on all sides
+var DefaultCrop = Crop{Mode: CropWindow, Width: 0.5, Height: 0.5, Anchor: AnchorCenter}
+
+// cropping returns true if the image is cropped to Crop. A CenterWeight replaces the default crop,
+// but a crop that was set explicitly is still applied
+func (o *Options) cropping() bool {
+	if o.NoCropping {
+		return false
+	}
+	return o.CenterWeight.Falloff == FalloffNone || o.Crop != DefaultCrop
+}
+
+// validate checks that the crop settings are in range
+func (c Crop) validate() error {
+	inRange := func(v float64) bool { return v > 0 && v <= 1 }
+
+	switch c.Mode {
+	case CropWindow, CropSalient:
+		if !inRange(c.Width) || !inRange(c.Height) {
+			return ErrInvalidCrop
+		}
+	case CropSides:
+		if c.Left < 0 || c.Top < 0 || c.Right < 0 || c.Bottom < 0 || c.Left+c.Right >= 1 || c.Top+c.Bottom >= 1 {
+			return ErrInvalidCrop
+		}
+	case CropRect:
+		if c.Rect.Empty() {
+			return ErrInvalidCrop
+		}
+	case CropAspect:
+		if c.AspectRatio <= 0 || !inRange(c.Scale) {
+			return ErrInvalidCrop
+		}
+	default:
+		return ErrInvalidMethod
+	}
+
+	if c.Anchor < AnchorCenter || c.Anchor > AnchorRightThird {
+		return ErrInvalidMethod
+	}
+	return nil
+}
+
+// position returns where the center of the window should be, as fractions of the width and height of the image
+func (a CropAnchor) position() (float64, float64) {
+	switch a {
+	case AnchorTop:
+		return 0.5, 0.0
+	case AnchorBottom:
+		return 0.5, 1.0
+	case AnchorLeft:
+		return 0.0, 0.5
+	case AnchorRight:
+		return 1.0, 0.5
+	case AnchorUpperThird:
+		return 0.5, 1.0 / 3.0
+	case AnchorLowerThird:
+		return 0.5, 2.0 / 3.0
+	case AnchorLeftThird:
+		return 1.0 / 3.0, 0.5
+	case AnchorRightThird:
+		return 2.0 / 3.0, 0.5
+	}
+	return 0.5, 0.5
+}
+
+// rect returns the region to keep of an image with the bounds b, it can be empty if Rect is outside the image
+func (c Crop) rect(b image.Rectangle) image.Rectangle {
+	dx, dy := float64(b.Dx()), float64(b.Dy())
+
+	switch c.Mode {
+	case CropSides:
+		return image.Rect(
+			b.Min.X+int(math.Floor(c.Left*dx)),
+			b.Min.Y+int(math.Floor(c.Top*dy)),
+			b.Max.X-int(math.Floor(c.Right*dx)),
+			b.Max.Y-int(math.Floor(c.Bottom*dy)),
+		)
+	case CropRect:
+		return c.Rect.Intersect(b)
+	case CropAspect:
+		w, h := dx, dy
+		if dx/dy > c.AspectRatio {
+			w = dy * c.AspectRatio
+		} else {
+			h = dx / c.AspectRatio
+		}
+		return c.window(b, int(w*c.Scale), int(h*c.Scale))
+	}
+	return c.window(b, int(c.Width*dx), int(c.Height*dy))
+}
+
+// window places a window of w x h at the anchor, keeping it inside b
+func (c Crop) window(b image.Rectangle, w, h int) image.Rectangle {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	fx, fy := c.Anchor.position()
+	x := int(math.Floor(fx*float64(b.Dx()) - float64(w)/2.0))
+	y := int(math.Floor(fy*float64(b.Dy()) - float64(h)/2.0))
+	x = clampInt(x, 0, b.Dx()-w)
+	y = clampInt(y, 0, b.Dy()-h)
+
+	return image.Rect(b.Min.X+x, b.Min.Y+y, b.Min.X+x+w, b.Min.Y+y+h)
+}
+
+// clampInt returns v limited to [min, max]
+func clampInt(v, min, max int) int {
+	if v > max {
+		v = max
+	}
+	if v < min {
+		v = min
+	}
+	return v
+}
+
+// cropRect returns the region of img selected by c
+func cropRect(c Crop, img image.Image) (image.Rectangle, error) {
+	var r image.Rectangle
+	if c.Mode == CropSalient {
+		r = salientWindow(img, c.Width, c.Height)
+	} else {
+		r = c.rect(img.Bounds())
+	}
+	if r.Empty() {
+		return r, ErrInvalidCrop
+	}
+	return r, nil
+}
+
+// cropImg returns the region r of img
+func cropImg(img image.Image, r image.Rectangle) (image.Image, error) {
+	b := img.Bounds()
+	return cutter.Crop(img, cutter.Config{
+		Width:  r.Dx(),
+		Height: r.Dy(),
+		Anchor: r.Min.Sub(b.Min),
+		Mode:   cutter.TopLeft,
+	})
+}
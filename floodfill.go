@@ -0,0 +1,188 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// ErrInvalidFloodFill is returned when the tolerance or max hole size of the flood fill is negative
+var ErrInvalidFloodFill = errors.New("flood fill tolerance and max hole size must not be negative")
+
+// FloodFill defines how the background is removed once a mask has matched. The zero value removes
+// the pixels matching the mask that are 4-connected to the corners (or border pixels, see DetectBorder)
+type FloodFill struct {
+	// Tolerance is the max distance in Lab (CIE76 ΔE) from the background color,
+	// the mean color of the seed pixels, for a pixel to be removed. With 0 each pixel is tested against the mask instead.
+	// Comparing to the background color handles noisy (e.g. JPEG compressed) backgrounds better than the mask thresholds
+	Tolerance float64
+	// EightConnected also spreads to diagonal neighbours, so the fill does not stop at diagonal gaps
+	EightConnected bool
+	// MaxHoleSize removes regions of at most this many pixels that are surrounded by removed (or transparent)
+	// pixels, e.g. specks of noise in the background. It must be smaller than the subject. 0 disables it
+	MaxHoleSize int
+}
+
+// validate checks that the values are not negative
+func (f FloodFill) validate() error {
+	if f.Tolerance < 0 || f.MaxHoleSize < 0 {
+		return ErrInvalidFloodFill
+	}
+	return nil
+}
+
+var (
+	neighbours4 = []image.Point{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}}
+	neighbours8 = []image.Point{{X: -1}, {X: 1}, {Y: -1}, {Y: 1}, {X: -1, Y: -1}, {X: 1, Y: -1}, {X: -1, Y: 1}, {X: 1, Y: 1}}
+)
+
+// neighbours returns the offsets to the 4 or 8 neighbours of a pixel
+func (f FloodFill) neighbours() []image.Point {
+	if f.EightConnected {
+		return neighbours8
+	}
+	return neighbours4
+}
+
+// fill removes the background starting from the seeds, returns the number of pixels marked transparent
+func (f FloodFill) fill(bgmask ColorBackgroundMask, imgDraw *draw.Image, seeds []image.Point) int {
+	match := func(x, y int) bool {
+		return ignorePixel(x, y, bgmask, imgDraw)
+	}
+	if f.Tolerance > 0 {
+		bgLab, ok := meanLab(imgDraw, seeds)
+		if !ok {
+			return 0
+		}
+		match = labMatch(imgDraw, bgLab, f.Tolerance)
+	}
+	return f.fillMatching(imgDraw, seeds, match)
+}
+
+// fillMatching removes the pixels that match and are connected to the seeds, and closes holes if MaxHoleSize is set
+func (f FloodFill) fillMatching(imgDraw *draw.Image, seeds []image.Point, match func(x, y int) bool) int {
+	numMarked := fillConnected(imgDraw, seeds, f.neighbours(), match)
+	if f.MaxHoleSize > 0 && numMarked > 0 {
+		numMarked += closeHoles(imgDraw, f.MaxHoleSize)
+	}
+	return numMarked
+}
+
+// labMatch returns a match function that is true for pixels within tolerance (ΔE) from bgLab
+func labMatch(imgDraw *draw.Image, bgLab [3]float64, tolerance float64) func(x, y int) bool {
+	return func(x, y int) bool {
+		return euclidean(pixelLab(imgDraw, x, y), bgLab) <= tolerance
+	}
+}
+
+// pixelLab returns the (un-premultiplied) color of the pixel in Lab, see deltaELab
+func pixelLab(imgDraw *draw.Image, x, y int) [3]float64 {
+	colorItem, _ := createColor((*imgDraw).At(x, y), 0)
+	return deltaELab(colorItem.toColorful())
+}
+
+// meanLab returns the mean color in Lab of the non-transparent points, false if all are transparent
+func meanLab(imgDraw *draw.Image, points []image.Point) ([3]float64, bool) {
+	var sum [3]float64
+	n := 0
+	for _, p := range points {
+		if isPixelTransparent(p.X, p.Y, imgDraw) {
+			continue
+		}
+		lab := pixelLab(imgDraw, p.X, p.Y)
+		for i := range sum {
+			sum[i] += lab[i]
+		}
+		n++
+	}
+	if n == 0 {
+		return sum, false
+	}
+	for i := range sum {
+		sum[i] /= float64(n)
+	}
+	return sum, true
+}
+
+// fillConnected marks the pixels that match and are connected to the seeds (through matching pixels) as transparent,
+// returns the number marked
+func fillConnected(imgDraw *draw.Image, seeds []image.Point, neighbours []image.Point, match func(x, y int) bool) int {
+	numMarked := 0
+	rect := (*imgDraw).Bounds()
+
+	pointsToProcess := append([]image.Point{}, seeds...)
+
+	var p image.Point
+	for len(pointsToProcess) > 0 {
+		//pop from slice
+		p, pointsToProcess = pointsToProcess[len(pointsToProcess)-1], pointsToProcess[:len(pointsToProcess)-1]
+
+		// marked pixels are transparent, so each pixel is only marked once
+		if isPixelTransparent(p.X, p.Y, imgDraw) || !match(p.X, p.Y) {
+			continue
+		}
+		markPixel(p.X, p.Y, imgDraw)
+		numMarked++
+
+		for _, d := range neighbours {
+			q := p.Add(d)
+			if q.In(rect) && !isPixelTransparent(q.X, q.Y, imgDraw) {
+				pointsToProcess = append(pointsToProcess, q)
+			}
+		}
+	}
+	return numMarked
+}
+
+// closeHoles marks the 4-connected regions of non-transparent pixels with at most maxSize pixels as transparent,
+// returns the number marked
+func closeHoles(imgDraw *draw.Image, maxSize int) int {
+	rect := (*imgDraw).Bounds()
+	visited := make([]bool, rect.Dx()*rect.Dy())
+	index := func(p image.Point) int {
+		return (p.Y-rect.Min.Y)*rect.Dx() + (p.X - rect.Min.X)
+	}
+
+	numMarked := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			start := image.Point{X: x, Y: y}
+			if visited[index(start)] || isPixelTransparent(x, y, imgDraw) {
+				continue
+			}
+
+			// collect the region, stop collecting (but keep visiting) once it is too large to be a hole
+			var region []image.Point
+			size := 0
+			visited[index(start)] = true
+			pointsToProcess := []image.Point{start}
+			for len(pointsToProcess) > 0 {
+				p := pointsToProcess[len(pointsToProcess)-1]
+				pointsToProcess = pointsToProcess[:len(pointsToProcess)-1]
+				size++
+				if size <= maxSize {
+					region = append(region, p)
+				}
+				for _, d := range neighbours4 {
+					q := p.Add(d)
+					if q.In(rect) && !visited[index(q)] && !isPixelTransparent(q.X, q.Y, imgDraw) {
+						visited[index(q)] = true
+						pointsToProcess = append(pointsToProcess, q)
+					}
+				}
+			}
+
+			if size <= maxSize {
+				for _, p := range region {
+					markPixel(p.X, p.Y, imgDraw)
+				}
+				numMarked += size
+			}
+		}
+	}
+	return numMarked
+}
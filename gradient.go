@@ -0,0 +1,186 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// BackgroundModel defines how the background color may vary over the image
+type BackgroundModel int
+
+const (
+	// ModelUniform is a single background color (default)
+	ModelUniform BackgroundModel = iota
+	// ModelPlanar is a linear gradient, each channel in Lab is a + b*x + c*y
+	ModelPlanar
+	// ModelRadial is a radial gradient or vignette around the center, each channel in Lab is a + b*r²
+	ModelRadial
+)
+
+// modelFitRounds is the number of times the model is refitted on the border pixels that are within tolerance of it,
+// so a watermark or shadow on the border does not skew the model
+const modelFitRounds = 3
+
+// bgModel is the background color in Lab as a function of the position, x and y are normalized to [-1,1]
+type bgModel struct {
+	kind BackgroundModel
+	rect image.Rectangle
+	// coef contains the coefficients for each of L, a and b
+	coef [3][]float64
+}
+
+// newUniformModel returns a model with the same color everywhere
+func newUniformModel(rect image.Rectangle, lab [3]float64) *bgModel {
+	m := &bgModel{kind: ModelUniform, rect: rect}
+	for c := 0; c < 3; c++ {
+		m.coef[c] = []float64{lab[c]}
+	}
+	return m
+}
+
+// features returns the terms the coefficients are multiplied with at the position
+func (m *bgModel) features(p image.Point) []float64 {
+	x := (float64(p.X-m.rect.Min.X)+0.5)/float64(m.rect.Dx())*2.0 - 1.0
+	y := (float64(p.Y-m.rect.Min.Y)+0.5)/float64(m.rect.Dy())*2.0 - 1.0
+	switch m.kind {
+	case ModelPlanar:
+		return []float64{1.0, x, y}
+	case ModelRadial:
+		return []float64{1.0, x*x + y*y}
+	}
+	return []float64{1.0}
+}
+
+// at returns the background color in Lab at the position
+func (m *bgModel) at(p image.Point) [3]float64 {
+	f := m.features(p)
+	var lab [3]float64
+	for c := 0; c < 3; c++ {
+		for i, v := range f {
+			lab[c] += m.coef[c][i] * v
+		}
+	}
+	return lab
+}
+
+// match returns a match function that is true for pixels within tolerance (ΔE) from the model
+func (m *bgModel) match(imgDraw *draw.Image, tolerance float64) func(x, y int) bool {
+	return func(x, y int) bool {
+		return euclidean(pixelLab(imgDraw, x, y), m.at(image.Point{X: x, Y: y})) <= tolerance
+	}
+}
+
+// fitModel fits a model of kind to the colors (in Lab) of the points with least squares,
+// refitting on the points within tolerance. Returns the model and the points within tolerance of it
+func fitModel(kind BackgroundModel, rect image.Rectangle, points []image.Point, labs [][3]float64, tolerance float64) (*bgModel, []image.Point) {
+	m := &bgModel{kind: kind, rect: rect}
+
+	inliers := make([]int, len(points))
+	for i := range inliers {
+		inliers[i] = i
+	}
+
+	var within []image.Point
+	for round := 0; round < modelFitRounds; round++ {
+		if !m.solve(points, labs, inliers) {
+			return nil, nil
+		}
+
+		within = within[:0]
+		var next []int
+		for i, p := range points {
+			if euclidean(labs[i], m.at(p)) <= tolerance {
+				next = append(next, i)
+				within = append(within, p)
+			}
+		}
+		if len(next) == 0 || len(next) == len(inliers) {
+			break
+		}
+		inliers = next
+	}
+	return m, within
+}
+
+// solve sets the coefficients to the least squares fit of the points with the indexes in use,
+// returns false if there are too few points to determine them
+func (m *bgModel) solve(points []image.Point, labs [][3]float64, use []int) bool {
+	n := len(m.features(image.Point{}))
+	if len(use) < n {
+		return false
+	}
+
+	// normal equations: (FᵀF) coef = Fᵀ lab
+	ata := make([][]float64, n)
+	for i := range ata {
+		ata[i] = make([]float64, n)
+	}
+	var atb [3][]float64
+	for c := range atb {
+		atb[c] = make([]float64, n)
+	}
+	for _, idx := range use {
+		f := m.features(points[idx])
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				ata[i][j] += f[i] * f[j]
+			}
+			for c := 0; c < 3; c++ {
+				atb[c][i] += f[i] * labs[idx][c]
+			}
+		}
+	}
+
+	for c := 0; c < 3; c++ {
+		coef, ok := solveLinear(ata, atb[c])
+		if !ok {
+			return false
+		}
+		m.coef[c] = coef
+	}
+	return true
+}
+
+// solveLinear solves the n x n system a x = b with gaussian elimination (partial pivoting), a and b are not modified
+func solveLinear(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = append(append([]float64{}, a[i]...), b[i])
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// gradientImage returns a vertical gray gradient with a red square in the middle,
+// and a dark watermark in the top left corner if watermark is set
+func gradientImage(watermark bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	for y := 0; y < 40; y++ {
+		v := uint8(110 + 3*y)
+		for x := 0; x < 60; x++ {
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	draw.Draw(img, image.Rect(20, 10, 40, 30), image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+	if watermark {
+		draw.Draw(img, image.Rect(0, 0, 8, 6), image.NewUniform(color.RGBA{20, 20, 60, 255}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestSolveLinear(t *testing.T) {
+	a := [][]float64{{2, 1, -1}, {-3, -1, 2}, {-2, 1, 2}}
+	b := []float64{8, -11, -3}
+	x, ok := solveLinear(a, b)
+	if !ok {
+		t.Fatal("no solution")
+	}
+	for i, want := range []float64{2, 3, -1} {
+		if math.Abs(x[i]-want) > 1e-9 {
+			t.Errorf("x[%d] is %v, want %v", i, x[i], want)
+		}
+	}
+	if a[0][0] != 2 || b[0] != 8 {
+		t.Error("input modified")
+	}
+
+	if _, ok := solveLinear([][]float64{{1, 2}, {2, 4}}, []float64{1, 2}); ok {
+		t.Error("singular system solved")
+	}
+}
+
+func TestGradientBackground(t *testing.T) {
+	img := gradientImage(false)
+	res, err := Analyze(img, WithGradientBackground(ModelPlanar, 6, 0.5), WithCropping(false), WithMasks(nil), WithK(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 60*40 - 20*20; res.PixelsMasked != want {
+		t.Errorf("masked %d pixels, want %d", res.PixelsMasked, want)
+	}
+	if len(res.Centroids) != 1 || res.Centroids[0].AsString() != "C81E1E" {
+		t.Errorf("got %v, want only the red square", res.Centroids)
+	}
+	if res.BackgroundConfidence < 0.99 {
+		t.Errorf("confidence is %v, want 1", res.BackgroundConfidence)
+	}
+}
+
+func TestFitModelWatermark(t *testing.T) {
+	fit := func(watermark bool) (*bgModel, []image.Point, int) {
+		var imgDraw draw.Image = image.NewRGBA64(image.Rect(0, 0, 60, 40))
+		src := gradientImage(watermark)
+		draw.Draw(imgDraw, src.Bounds(), src, image.Point{}, draw.Src)
+
+		border := borderPixels(imgDraw.Bounds())
+		labs := make([][3]float64, len(border))
+		for i, p := range border {
+			labs[i] = pixelLab(&imgDraw, p.X, p.Y)
+		}
+		m, seeds := fitModel(ModelPlanar, imgDraw.Bounds(), border, labs, 6)
+		if m == nil {
+			t.Fatalf("watermark %v: no model", watermark)
+		}
+		return m, seeds, len(border)
+	}
+
+	clean, cleanSeeds, numBorder := fit(false)
+	marked, markedSeeds, _ := fit(true)
+
+	if len(cleanSeeds) != numBorder {
+		t.Errorf("%d of %d border pixels fit the clean gradient", len(cleanSeeds), numBorder)
+	}
+	for _, p := range markedSeeds {
+		if p.In(image.Rect(0, 0, 8, 6)) {
+			t.Errorf("watermark pixel %v is a seed", p)
+		}
+	}
+	for _, p := range []image.Point{{0, 0}, {59, 0}, {30, 20}, {0, 39}, {59, 39}} {
+		if d := euclidean(clean.at(p), marked.at(p)); d > 1.0 {
+			t.Errorf("at %v the model moved %v ΔE with a watermark", p, d)
+		}
+	}
+}
@@ -18,11 +18,14 @@ import (
 	"fmt"
 
 	"github.com/nfnt/resize"
-	"github.com/oliamb/cutter"
 )
 
-// ColorBackgroundMask defines which color channels to look for color to ignore
+// ColorBackgroundMask defines which color channels to look for color to ignore.
+// With Kind MaskDeltaE or MaskHSV the color is matched perceptually instead, see NewDeltaEMask and NewHSVMask
 type ColorBackgroundMask struct {
+	// Kind selects how pixels are matched, the zero value MaskChannels uses R,G,B, Treshold and PercDiff
+	Kind MaskKind
+
 	// Setting them all to true or all to false; Treshold is used, otherwise PercDiff
 	R, G, B bool
 
@@ -31,119 +34,132 @@ type ColorBackgroundMask struct {
 
 	// PercDiff if any of R,G,B is true (but not all), any of the other colors divided by the color value that is true, must be below PercDiff
 	PercDiff float32
+
+	// Center is the color (8 bits per channel) and Radius the max distance from it in Lab (CIE76 ΔE), for MaskDeltaE
+	Center ColorRGB
+	Radius float64
+
+	// HSV is the range of colors that match, for MaskHSV
+	HSV HSVRange
+}
+
+// validate checks that the mask does not contain values that are out of range or that will be ignored
+func (bgmask ColorBackgroundMask) validate() error {
+	if bgmask.Kind != MaskChannels {
+		return bgmask.validatePerceptual()
+	}
+	if bgmask.Radius != 0 || bgmask.HSV != (HSVRange{}) || bgmask.Center != (ColorRGB{}) {
+		return ErrContradictoryMask
+	}
+	if bgmask.Treshold > 0xffff {
+		return ErrInvalidMask
+	}
+	if bgmask.PercDiff < 0 {
+		return ErrInvalidMask
+	}
+
+	allSame := (bgmask.R && bgmask.G && bgmask.B) || !(bgmask.R || bgmask.G || bgmask.B)
+	if allSame {
+		// PercDiff is not used when looking for white/black
+		if bgmask.PercDiff != 0 {
+			return ErrContradictoryMask
+		}
+		return nil
+	}
+
+	// Treshold is not used when comparing channels, and without PercDiff nothing would match
+	if bgmask.Treshold != 0 || bgmask.PercDiff == 0 {
+		return ErrContradictoryMask
+	}
+	return nil
 }
 
 // ProcessImg process the image and mark unwanted pixels transparent.
 // It checks the corners, if not all of them match the mask, we conclude it's not a clipart/solid background and do nothing
 func ProcessImg(arguments int, bgmasks []ColorBackgroundMask, img image.Image) draw.Image {
+	opts := DefaultOptions()
+	WithArguments(arguments)(&opts)
+	opts.Masks = bgmasks
+	imgDraw, _ := processImg(&opts, img)
+	return imgDraw
+}
+
+// processImg is ProcessImg using the settings in opts,
+// it also returns which mask was applied (if any), how much of the border matched and the number of pixels it marked transparent
+func processImg(opts *Options, img image.Image) (draw.Image, background) {
 	imgDraw := createDrawImage(img)
-	rect := imgDraw.Bounds()
-
-	//loop through the masks, and the first one that matches on the four corners is the one that will be used
-	foundMaskThatmatched := false
-	var bgmaskToUse ColorBackgroundMask
-	for _, bgmask := range bgmasks {
-		// Check the corners, if not all of them are the color of the mask,
-		// we conclude it's not a solid background and do nothing special
-		if !ignorePixel(rect.Min.X, rect.Min.Y, bgmask, &imgDraw) || !ignorePixel(rect.Min.X, rect.Max.Y-1, bgmask, &imgDraw) || !ignorePixel(rect.Max.X-1, rect.Min.Y, bgmask, &imgDraw) || !ignorePixel(rect.Max.X-1, rect.Max.Y-1, bgmask, &imgDraw) {
-			continue
-		}
-		foundMaskThatmatched = true
-		bgmaskToUse = bgmask
-	}
 
-	// no mask that we can apply
-	if !foundMaskThatmatched {
-		return imgDraw
+	var bg background
+	if opts.AutoBackground.enabled() {
+		bg = estimateBackground(opts, &imgDraw)
+	} else {
+		bg = detectBackground(opts, &imgDraw)
 	}
 
-	ProcessImgOutline(bgmaskToUse, &imgDraw)
+	switch {
+	case bg.remove:
+		bg.numMasked = opts.FloodFill.fillMatching(&imgDraw, bg.seeds, bg.model.match(&imgDraw, opts.AutoBackground.Tolerance))
+	case bg.mask == nil:
+		// no mask that we can apply
+		return imgDraw, bg
+	default:
+		bg.numMasked = opts.FloodFill.fill(*bg.mask, &imgDraw, bg.seeds)
+	}
 
 	// if debug argument is set, save a tmp file to be able to view what was masked out
-	if IsBitSet(arguments, ArgumentDebugImage) {
+	if opts.DebugImage {
 		tmpFilename := fmt.Sprintf("/tmp/tmp%d.jpg", time.Now().UnixNano()/1000000)
 		toimg, _ := os.Create(tmpFilename)
 		defer toimg.Close()
 		jpeg.Encode(toimg, imgDraw, &jpeg.Options{Quality: 100})
 	}
 
-	return imgDraw
+	return imgDraw, bg
 }
 
 // ProcessImgOutline follow the outline of the image and mark all "white" pixels as transparent
 func ProcessImgOutline(bgmask ColorBackgroundMask, imgDraw *draw.Image) {
-
-	rect := (*imgDraw).Bounds()
-
-	var pointsToProcess []image.Point
-
 	// points to add to start processing: corners only
-	pointsToProcess = append(pointsToProcess, image.Point{X: rect.Min.X, Y: rect.Min.Y})
-	pointsToProcess = append(pointsToProcess, image.Point{X: rect.Min.X, Y: rect.Max.Y - 1})
-	pointsToProcess = append(pointsToProcess, image.Point{X: rect.Max.X - 1, Y: rect.Min.Y})
-	pointsToProcess = append(pointsToProcess, image.Point{X: rect.Max.X - 1, Y: rect.Max.Y - 1})
-
-	var p image.Point
-	for len(pointsToProcess) > 0 {
-		//pop from slice
-		p, pointsToProcess = pointsToProcess[len(pointsToProcess)-1], pointsToProcess[:len(pointsToProcess)-1]
-
-		if !isPixelTransparent(p.X, p.Y, imgDraw) && ignorePixel(p.X, p.Y, bgmask, (imgDraw)) {
-
-			//Mark the pixel
-			markPixel(p.X, p.Y, (imgDraw))
-			if !isPixelTransparent(p.X, p.Y, imgDraw) {
-				log.Println("ERROR: marking")
-			}
-
-			//add pixels above, below, left,right
-			//unless its transparent
-			if rect.Min.X < p.X {
-				if !isPixelTransparent(p.X-1, p.Y, imgDraw) {
-					pointsToProcess = append(pointsToProcess, image.Point{X: p.X - 1, Y: p.Y})
-				}
-			}
-
-			if p.X < rect.Max.X-1 {
-				if !isPixelTransparent(p.X+1, p.Y, imgDraw) {
-					pointsToProcess = append(pointsToProcess, image.Point{X: p.X + 1, Y: p.Y})
-				}
-			}
-
-			if rect.Min.Y < p.Y {
-				if !isPixelTransparent(p.X, p.Y-1, imgDraw) {
-					pointsToProcess = append(pointsToProcess, image.Point{X: p.X, Y: p.Y - 1})
-				}
-			}
-
-			if p.Y < rect.Max.Y-1 {
-				if !isPixelTransparent(p.X, p.Y+1, imgDraw) {
-					pointsToProcess = append(pointsToProcess, image.Point{X: p.X, Y: p.Y + 1})
-				}
-			}
-		}
-	}
+	FloodFill{}.fill(bgmask, imgDraw, corners((*imgDraw).Bounds()))
 }
 
-// createDrawImage creates a draw.Image so we can work with the single pixels
+// createDrawImage creates a draw.Image so we can work with the single pixels, it is 16 bit to not lose any precision
 func createDrawImage(img image.Image) draw.Image {
 	b := img.Bounds()
-	cimg := image.NewRGBA(b)
+	cimg := image.NewRGBA64(b)
 	draw.Draw(cimg, b, img, b.Min, draw.Src)
 	return cimg
 }
 
-// prepareImg resizes to a smaller size and remove any "white" background pixels for isolated/clipart images
-func prepareImg(arguments int, bgmasks []ColorBackgroundMask, imageSize uint, orgimg image.Image) image.Image {
+// prepareImg resizes to a smaller size and remove any "white" background pixels for isolated/clipart images.
+// The time spent in each stage, the mask applied and the pixel counts are stored in res
+func prepareImg(opts *Options, orgimg image.Image, res *Result) (image.Image, error) {
+	if err := opts.checkPixelMask(orgimg); err != nil {
+		return nil, err
+	}
 
-	if !IsBitSet(arguments, ArgumentNoCropping) {
-		// crop to remove 25% on all sides
-		croppedimg, err := cutter.Crop(orgimg, cutter.Config{
-			Width:  int(orgimg.Bounds().Dx() / 2),
-			Height: int(orgimg.Bounds().Dy() / 2),
-			Mode:   cutter.Centered,
-		})
+	start := time.Now()
+	rect := orgimg.Bounds()
+	if opts.cropping() {
+		// crop to the region in opts, as default removing 25% on all sides
+		r, err := cropRect(opts.Crop, orgimg)
+		switch {
+		case err == nil:
+			rect = r
+		case opts.Crop != DefaultCrop:
+			// the region the caller asked for is not in the image
+			return nil, &OptionError{Option: "Crop", Err: err}
+		default:
+			log.Println("Warning: failed cropping")
+			log.Println(err)
+		}
+	}
 
+	if opts.hasPixelMask() {
+		// the caller's mask is cropped together with the image, and resized with it since it ends up in the alpha
+		orgimg = applyPixelMask(opts, orgimg, rect)
+	} else if rect != orgimg.Bounds() {
+		croppedimg, err := cropImg(orgimg, rect)
 		if err != nil {
 			log.Println("Warning: failed cropping")
 			log.Println(err)
@@ -151,16 +167,38 @@ func prepareImg(arguments int, bgmasks []ColorBackgroundMask, imageSize uint, or
 			orgimg = croppedimg
 		}
 	}
+	res.Timings.Crop = time.Since(start)
 
 	// Don't resize if the image is smaller than imageSize
+	start = time.Now()
+	imageSize := opts.Size
 	rec := orgimg.Bounds()
 
 	if uint(rec.Dx()) > imageSize || uint(rec.Dy()) > imageSize {
-		img := resize.Resize(imageSize, 0, orgimg, resize.Lanczos3)
-		return ProcessImg(arguments, bgmasks, img)
+		if opts.LinearLight {
+			// resize in linear light so the mixed pixels get the correct brightness
+			orgimg = encodeImage(resize.Resize(imageSize, 0, linearizeImage(orgimg), resize.Lanczos3))
+		} else {
+			orgimg = resize.Resize(imageSize, 0, orgimg, resize.Lanczos3)
+		}
+	}
+	res.Timings.Resize = time.Since(start)
+
+	start = time.Now()
+	img, info, err := removeBackground(opts, orgimg)
+	res.Timings.Mask = time.Since(start)
+	if err != nil {
+		return nil, err
 	}
 
-	return ProcessImg(arguments, bgmasks, orgimg)
+	res.PixelsTotal = img.Bounds().Dx() * img.Bounds().Dy()
+	res.PixelsMasked = info.PixelsMasked
+	res.Mask = info.Mask
+	res.BorderMatch = info.BorderMatch
+	res.BackgroundColor = info.Color
+	res.BackgroundConfidence = info.Confidence
+
+	return img, nil
 }
 
 // markPixel sets a purple color (to make it stick out if we want to look at the image) and makes the pixel transparent
@@ -185,6 +223,10 @@ func ignorePixel(x, y int, bgmask ColorBackgroundMask, img *draw.Image) bool {
 		return true
 	}
 
+	if bgmask.Kind != MaskChannels {
+		return bgmask.matchPerceptual(colorAt)
+	}
+
 	//if looking for black
 	if !(bgmask.R || bgmask.G || bgmask.B) {
 		if r > bgmask.Treshold {
@@ -9,14 +9,11 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"log"
 	"math/rand"
 
 	"sort"
 
 	"time"
-
-	"github.com/lucasb-eyer/go-colorful"
 )
 
 const (
@@ -28,7 +25,7 @@ const (
 	ArgumentAverageMean
 	// ArgumentNoCropping do not crop background that is considered "white"
 	ArgumentNoCropping
-	// ArgumentLAB (experimental, it seems to be buggy in some cases): uses LAB instead of RGB when measuring distance
+	// ArgumentLAB clusters in LAB instead of RGB, see SpaceLab
 	ArgumentLAB
 	// ArgumentDebugImage saves a tmp file in /tmp/ where the area that has been cut away by the mask is marked pink
 	// useful when figuring out what values to pick for the masks
@@ -40,6 +37,8 @@ const (
 	DefaultK = 3
 	// DefaultSize is the default size images are re-sized to
 	DefaultSize = 80
+	// DefaultMaxIterations is the default max number of k-means rounds
+	DefaultMaxIterations = 5000
 )
 
 var (
@@ -61,8 +60,37 @@ type ColorRGB struct {
 
 // ColorItem contains color and have many occurrences of this color found
 type ColorItem struct {
+	// Color is the color with 8 bits per channel
 	Color ColorRGB
-	Cnt   int
+	// Color16 is the color with 16 bits per channel, as precise as the image (and the clustering) allows
+	Color16 ColorRGB
+	Cnt     int
+	// Weight is the sum of the alpha (in [0,1]) of the pixels, equal to Cnt if all pixels are opaque.
+	// Semi-transparent pixels count less when averaging and when ordering according to dominance
+	Weight float64
+}
+
+// newColorItem creates a ColorItem from 16 bit values, Color is set to the values rounded to 8 bits
+func newColorItem(r, g, b uint32, cnt int, weight float64) ColorItem {
+	return ColorItem{
+		Color:   ColorRGB{R: to8Bit(r), G: to8Bit(g), B: to8Bit(b)},
+		Color16: ColorRGB{R: r, G: g, B: b},
+		Cnt:     cnt,
+		Weight:  weight,
+	}
+}
+
+// to8Bit rounds the 16 bit value to 8 bits
+func to8Bit(v uint32) uint32 {
+	return (v*255 + 0x7fff) / 0xffff
+}
+
+// rgb16 returns Color16, or Color scaled to 16 bits if the item was created with only Color set
+func (c *ColorItem) rgb16() ColorRGB {
+	if c.Color16 == (ColorRGB{}) && c.Color != (ColorRGB{}) {
+		return ColorRGB{R: c.Color.R * 0x101, G: c.Color.G * 0x101, B: c.Color.B * 0x101}
+	}
+	return c.Color16
 }
 
 // AsString gives back the color in hex as 6 character string
@@ -70,17 +98,70 @@ func (c *ColorItem) AsString() string {
 	return fmt.Sprintf("%.2X%.2X%.2X", c.Color.R, c.Color.G, c.Color.B)
 }
 
-// createColor returns ColorItem struct unless it was a transparent color
-func createColor(c color.Color) (ColorItem, bool) {
+// RGB8 returns the color with 8 bits per channel
+func (c *ColorItem) RGB8() (r, g, b uint8) {
+	return uint8(c.Color.R), uint8(c.Color.G), uint8(c.Color.B)
+}
+
+// RGB16 returns the color with 16 bits per channel
+func (c *ColorItem) RGB16() (r, g, b uint16) {
+	c16 := c.rgb16()
+	return uint16(c16.R), uint16(c16.G), uint16(c16.B)
+}
+
+// RGBFloat returns the color with each channel in [0,1]
+func (c *ColorItem) RGBFloat() (r, g, b float64) {
+	c16 := c.rgb16()
+	return float64(c16.R) / 0xffff, float64(c16.G) / 0xffff, float64(c16.B) / 0xffff
+}
+
+// OKLab returns the color in OKLab, L is in [0,1]
+func (c *ColorItem) OKLab() (l, a, b float64) {
+	return c.toColorful().OkLab()
+}
+
+// OKLCh returns the color in OKLCh (the polar form of OKLab), L is in [0,1] and h in degrees [0,360)
+func (c *ColorItem) OKLCh() (l, chroma, h float64) {
+	return c.toColorful().OkLch()
+}
+
+// HSV returns the color in HSV, h in degrees [0,360), s and v in [0,1]
+func (c *ColorItem) HSV() (h, s, v float64) {
+	return c.toColorful().Hsv()
+}
+
+// HSL returns the color in HSL, h in degrees [0,360), s and l in [0,1]
+func (c *ColorItem) HSL() (h, s, l float64) {
+	return c.toColorful().Hsl()
+}
+
+// createColor returns ColorItem struct unless it was a transparent color (alpha below minAlpha, or 0).
+// The color is un-premultiplied and Weight is set to the alpha
+func createColor(c color.Color, minAlpha float64) (ColorItem, bool) {
 	r, g, b, a := c.RGBA()
 
-	if a == 0 {
+	alpha := float64(a) / 0xffff
+	if a == 0 || alpha < minAlpha {
 		// transparent pixels are ignored
 		return ColorItem{}, true
 	}
 
-	divby := uint32(256.0)
-	return ColorItem{Color: ColorRGB{R: r / divby, G: g / divby, B: b / divby}}, false
+	if a < 0xffff {
+		// resampling can overshoot so a channel is larger than the alpha, which is not a valid premultiplied color
+		r, g, b = minUint32(r, a), minUint32(g, a), minUint32(b, a)
+		r = r * 0xffff / a
+		g = g * 0xffff / a
+		b = b * 0xffff / a
+	}
+	return newColorItem(r, g, b, 0, alpha), false
+}
+
+// minUint32 returns the smaller of a and b
+func minUint32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 // IsBitSet check if "lookingfor" is set in "bitset"
@@ -106,72 +187,186 @@ func KmeansWithArgs(arguments int, orgimg image.Image) (centroids []ColorItem, e
 
 // KmeansWithAll takes additional arguments to define k, arguments (see constants Argument*), size to resize and masks to use
 func KmeansWithAll(k int, orgimg image.Image, arguments int, imageReSize uint, bgmasks []ColorBackgroundMask) ([]ColorItem, error) {
+	return Extract(orgimg, WithK(k), WithArguments(arguments), WithSize(imageReSize), WithMasks(bgmasks))
+}
 
-	img := prepareImg(arguments, bgmasks, imageReSize, orgimg)
+// Extract finds the K most prominent colors in the image, using DefaultOptions modified by opts.
+// It returns the centroids sorted according to dominance (most frequent first),
+// or an *OptionError if the options are not valid.
+func Extract(orgimg image.Image, opts ...Option) ([]ColorItem, error) {
+	res, err := Analyze(orgimg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.Centroids, nil
+}
+
+// Analyze is like Extract but returns a Result, which besides the centroids
+// contains the share of each centroid and diagnostics about how they were found
+func Analyze(orgimg image.Image, opts ...Option) (*Result, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return analyze(o, orgimg)
+}
 
-	allColors, _ := extractColorsAsArray(img)
+// analyze runs the whole pipeline with already validated options
+func analyze(opts *Options, orgimg image.Image) (*Result, error) {
+	res := &Result{}
 
-	numColors := len(allColors)
+	img, err := prepareImg(opts, orgimg, res)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	allColors, numPixels := extractColorsAsArray(opts, img)
+	res.PixelsConsidered = numPixels
 
-	if numColors == 0 {
+	if len(allColors) == 0 {
 		return nil, ErrNoPixelsFound
 	}
 
-	if numColors == 1 {
-		return allColors, nil
+	cl, err := cluster(opts, img, allColors)
+	if err != nil {
+		return nil, err
 	}
+	res.Timings.Cluster = time.Since(start)
+
+	res.setClustering(opts, cl)
+
+	return res, nil
+}
 
-	if numColors <= k {
-		sortCentroids(allColors)
-		return allColors, nil
+// clustering is the outcome of running k-means on the unique colors
+type clustering struct {
+	// centroids sorted according to dominance
+	centroids []point
+	// clusters contains the colors belonging to each centroid (same order as centroids)
+	clusters   [][]point
+	iterations int
+	converged  bool
+}
+
+// cluster groups allColors (the colors in img) into k clusters using the algorithm in opts,
+// unless there are no more than k colors in which case they are returned as is
+func cluster(opts *Options, img image.Image, allColors []ColorItem) (*clustering, error) {
+	points := toPoints(opts.colorSpace(), allColors)
+	numColors := len(points)
+
+	if numColors <= opts.K {
+		centroids := make([]point, numColors)
+		clusters := make([][]point, numColors)
+		for i, aPoint := range points {
+			centroids[i] = aPoint
+			clusters[i] = []point{aPoint}
+		}
+		cl := &clustering{centroids: centroids, clusters: clusters, converged: true}
+		cl.sort()
+		return cl, nil
 	}
 
-	centroids, err := kmeansSeed(k, allColors, arguments)
+	switch opts.Algorithm {
+	case AlgorithmMedianCut:
+		return medianCut(opts, points), nil
+	case AlgorithmOctree:
+		return octreeQuantize(opts, img, points), nil
+	case AlgorithmWu:
+		return wuQuantize(opts, points), nil
+	}
+	return kmeans(opts, points)
+}
+
+// kmeans runs k-means on the points
+func kmeans(opts *Options, points []point) (*clustering, error) {
+	k := opts.K
+
+	centroids, err := kmeansSeed(k, points, opts, opts.newRand())
 	if err != nil {
 		return nil, err
 	}
 
-	cent := make([][]ColorItem, k)
+	// the seeding might not be able to find k distinct centroids
+	k = len(centroids)
+
+	cent := make([][]point, k)
 
 	//initialize
-	cent[0] = allColors
+	cent[0] = points
 	for i := 1; i < k; i++ {
-		cent[i] = []ColorItem{}
+		cent[i] = []point{}
 	}
 
 	//rounds is a safety net to make sure we terminate if its a bug in our distance function (or elsewhere) that makes k-means not terminate
 	rounds := 0
-	maxRounds := 5000
+	maxRounds := opts.MaxIterations
 	changes := 1
 
 	for changes > 0 && rounds < maxRounds {
 		changes = 0
-		tmpCent := make([][]ColorItem, k)
+		tmpCent := make([][]point, k)
 		for i := 0; i < k; i++ {
-			tmpCent[i] = []ColorItem{}
+			tmpCent[i] = []point{}
 		}
 
 		for i := 0; i < k; i++ {
-			for _, aColor := range cent[i] {
-				closestCentroid := findClosest(arguments, aColor, centroids)
+			for _, aPoint := range cent[i] {
+				closestCentroid := findClosest(opts, aPoint, centroids)
 
-				tmpCent[closestCentroid] = append(tmpCent[closestCentroid], aColor)
+				tmpCent[closestCentroid] = append(tmpCent[closestCentroid], aPoint)
 				if closestCentroid != i {
 					changes++
 				}
 			}
 		}
 		cent = tmpCent
-		centroids = calculateCentroids(cent, arguments)
+		centroids = calculateCentroids(cent, centroids, opts)
 		rounds++
 	}
 
-	if rounds >= maxRounds {
-		log.Println("Warning: terminated k-means due to max number of iterations")
+	cl := &clustering{centroids: centroids, clusters: cent, iterations: rounds, converged: changes == 0}
+	cl.sort()
+	return cl, nil
+}
+
+// sort sorts the centroids from most dominant color descending, keeping clusters in the same order
+func (cl *clustering) sort() {
+	sort.Stable(sort.Reverse(clusteringByCnt{cl}))
+}
+
+// items returns the colors of the centroids
+func (cl *clustering) items() []ColorItem {
+	items := make([]ColorItem, len(cl.centroids))
+	for i, centroid := range cl.centroids {
+		items[i] = centroid.item
+	}
+	return items
+}
+
+// inertia is the sum of the squared distance from each pixel to its centroid
+func (cl *clustering) inertia(opts *Options) float64 {
+	sum := 0.0
+	for i, colors := range cl.clusters {
+		for _, aPoint := range colors {
+			sum += aPoint.item.Weight * squaredDistance(opts, aPoint, cl.centroids[i])
+		}
 	}
+	return sum
+}
+
+// clusteringByCnt sorts a clustering the same way as byColorCnt, moving the clusters along with the centroids
+type clusteringByCnt struct {
+	cl *clustering
+}
 
-	sortCentroids(centroids)
-	return centroids, nil
+func (a clusteringByCnt) Len() int { return len(a.cl.centroids) }
+func (a clusteringByCnt) Swap(i, j int) {
+	a.cl.centroids[i], a.cl.centroids[j] = a.cl.centroids[j], a.cl.centroids[i]
+	a.cl.clusters[i], a.cl.clusters[j] = a.cl.clusters[j], a.cl.clusters[i]
+}
+func (a clusteringByCnt) Less(i, j int) bool {
+	return byColorCnt{a.cl.centroids[i].item, a.cl.centroids[j].item}.Less(0, 1)
 }
 
 // ByColorCnt makes the ColorItem sortable
@@ -180,142 +375,207 @@ type byColorCnt []ColorItem
 func (a byColorCnt) Len() int      { return len(a) }
 func (a byColorCnt) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a byColorCnt) Less(i, j int) bool {
+	if a[i].Weight != a[j].Weight {
+		return a[i].Weight < a[j].Weight
+	}
 	if a[i].Cnt == a[j].Cnt {
+		if a[i].Color == a[j].Color {
+			return lessRGB(a[i].rgb16(), a[j].rgb16())
+		}
 		return a[i].AsString() < a[j].AsString()
 	}
 	return a[i].Cnt < a[j].Cnt
 }
 
+// lessRGB orders colors on r, then g, then b
+func lessRGB(a, b ColorRGB) bool {
+	if a.R != b.R {
+		return a.R < b.R
+	}
+	if a.G != b.G {
+		return a.G < b.G
+	}
+	return a.B < b.B
+}
+
 // sortCentroids sorts them from most dominant color descending
 func sortCentroids(centroids []ColorItem) {
 	sort.Sort(sort.Reverse(byColorCnt(centroids)))
 }
 
-func calculateCentroids(cent [][]ColorItem, arguments int) []ColorItem {
-	var centroids []ColorItem
+// calculateCentroids averages each cluster in the color space, an empty cluster keeps its previous centroid (if any)
+func calculateCentroids(cent [][]point, previous []point, opts *Options) []point {
+	var centroids []point
 
-	for _, colors := range cent {
+	space := opts.colorSpace()
+	for i, colors := range cent {
 
-		var meanColor ColorItem
-		if IsBitSet(arguments, ArgumentAverageMean) {
-			meanColor = mean(colors)
-		} else {
-			meanColor = median(colors)
+		cntInThisBucket := 0
+		weightInThisBucket := 0.0
+		for _, aPoint := range colors {
+			cntInThisBucket += aPoint.item.Cnt
+			weightInThisBucket += aPoint.item.Weight
+		}
+
+		if len(colors) == 0 {
+			var centroid point
+			if i < len(previous) {
+				centroid = previous[i]
+				centroid.item.Cnt = 0
+				centroid.item.Weight = 0
+			}
+			centroids = append(centroids, centroid)
+			continue
 		}
 
-		centroids = append(centroids, meanColor)
+		centroids = append(centroids, toCentroid(space, space.average(opts, colors), cntInThisBucket, weightInThisBucket))
 	}
 
 	return centroids
 }
 
-// mean calculate the mean color values from an array of colors
-func mean(colors []ColorItem) ColorItem {
-
-	var r, g, b float64
-
-	r, g, b = 0.0, 0.0, 0.0
-
-	cntInThisBucket := 0
-	for _, aColor := range colors {
-		cntInThisBucket += aColor.Cnt
-		r += float64(aColor.Color.R)
-		g += float64(aColor.Color.G)
-		b += float64(aColor.Color.B)
+// averageChannels calculates the centroid of the points by averaging each coordinate separately
+func averageChannels(method AverageMethod, points []point) [3]float64 {
+	var v [3]float64
+	for c := 0; c < 3; c++ {
+		switch method {
+		case AverageMean:
+			v[c] = mean(points, c)
+		case AverageWeightedMean:
+			v[c] = weightedMean(points, c)
+		case AverageWeightedMedian:
+			v[c] = weightedMedian(points, c)
+		default:
+			v[c] = median(points, c)
+		}
 	}
-
-	theSize := float64(len(colors))
-
-	return ColorItem{Cnt: cntInThisBucket, Color: ColorRGB{R: uint32(r / theSize), G: uint32(g / theSize), B: uint32(b / theSize)}}
+	return v
 }
 
-// median calculate the median color from an array of colors
-func median(colors []ColorItem) ColorItem {
+// mean calculate the mean value of coordinate c from an array of colors
+func mean(points []point, c int) float64 {
+	if len(points) == 0 {
+		return 0.0
+	}
 
-	var rValues, gValues, bValues []int
+	sum := 0.0
+	for _, aPoint := range points {
+		sum += aPoint.v[c]
+	}
+	return sum / float64(len(points))
+}
 
-	cntInThisBucket := 0
+// weightedMean calculate the mean value of coordinate c from an array of colors, where each color counts as many times as it occurs
+// (weighted by alpha)
+func weightedMean(points []point, c int) float64 {
+	sum, weight := 0.0, 0.0
+	for _, aPoint := range points {
+		sum += aPoint.item.Weight * aPoint.v[c]
+		weight += aPoint.item.Weight
+	}
+	if weight == 0 {
+		return 0.0
+	}
+	return sum / weight
+}
 
-	for _, aColor := range colors {
-		cntInThisBucket += aColor.Cnt
-		rValues = append(rValues, int(aColor.Color.R))
-		gValues = append(gValues, int(aColor.Color.G))
-		bValues = append(bValues, int(aColor.Color.B))
+// median calculate the median value of coordinate c from an array of colors
+func median(points []point, c int) float64 {
+	if len(points) == 0 {
+		return 0.0
 	}
 
-	retR := 0
-	if 0 != len(rValues) {
-		sort.Ints(rValues)
-		retR = rValues[int(len(rValues)/2)]
+	values := make([]float64, len(points))
+	for i, aPoint := range points {
+		values[i] = aPoint.v[c]
 	}
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
 
-	retG := 0
-	if 0 != len(gValues) {
-		sort.Ints(gValues)
-		retG = gValues[int(len(gValues)/2)]
+// weightedMedian calculate the median value of coordinate c from an array of colors, where each color counts as many times as it occurs
+// (weighted by alpha)
+func weightedMedian(points []point, c int) float64 {
+	if len(points) == 0 {
+		return 0.0
 	}
 
-	retB := 0
-	if 0 != len(bValues) {
-		sort.Ints(bValues)
-		retB = bValues[int(len(bValues)/2)]
+	sorted := make([]point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].v[c] < sorted[j].v[c]
+	})
+
+	total := 0.0
+	for _, aPoint := range sorted {
+		total += aPoint.item.Weight
 	}
 
-	return ColorItem{Cnt: cntInThisBucket, Color: ColorRGB{R: uint32(retR), G: uint32(retG), B: uint32(retB)}}
+	sofar := 0.0
+	for _, aPoint := range sorted {
+		sofar += aPoint.item.Weight
+		if sofar*2 > total {
+			return aPoint.v[c]
+		}
+	}
+	return sorted[len(sorted)-1].v[c]
 }
 
-// extractColorsAsArray counts the number of occurrences of each color in the image, returns array and numPixels
-func extractColorsAsArray(img image.Image) ([]ColorItem, int) {
-	m, numPixels := extractColors(img)
+// extractColorsAsArray counts the number of occurrences of each color in the image, returns array and numPixels.
+// The array is sorted (most frequent first) so the order does not depend on map iteration, which keeps seeding reproducible
+func extractColorsAsArray(opts *Options, img image.Image) ([]ColorItem, int) {
+	m, numPixels := extractColors(img, opts.MinAlpha, newWeightMap(opts, img))
 	v := make([]ColorItem, len(m))
 	idx := 0
 	for _, value := range m {
 		v[idx] = value
 		idx++
 	}
+	sortCentroids(v)
 
 	return v, numPixels
 }
 
-// extractColors counts the number of occurrences of each color in the image, returns map
-func extractColors(img image.Image) (map[string]ColorItem, int) {
+// extractColors counts the number of occurrences of each (16 bit) color in the image, returns map.
+// Pixels with alpha below minAlpha, or without weight in wm, are ignored
+func extractColors(img image.Image, minAlpha float64, wm *weightMap) (map[ColorRGB]ColorItem, int) {
 
-	m := make(map[string]ColorItem)
+	m := make(map[ColorRGB]ColorItem)
 
 	numPixels := 0
 	data := img.Bounds()
 	for x := data.Min.X; x < data.Max.X; x++ {
 		for y := data.Min.Y; y < data.Max.Y; y++ {
-			colorAt := img.At(x, y)
-			colorItem, ignore := createColor(colorAt)
+			colorItem, ignore := pixelColor(img, x, y, minAlpha, wm)
 			if ignore {
 				continue
 			}
 			numPixels++
-			asString := colorItem.AsString()
-			value, ok := m[asString]
+			key := colorItem.Color16
+			value, ok := m[key]
 			if ok {
 				value.Cnt++
-				m[asString] = value
+				value.Weight += colorItem.Weight
+				m[key] = value
 			} else {
 				colorItem.Cnt = 1
-				m[asString] = colorItem
+				m[key] = colorItem
 			}
 		}
 	}
 	return m, numPixels
 }
 
-// findClosest returns the index of the closest centroid to the color "c"
-func findClosest(arguments int, c ColorItem, centroids []ColorItem) int {
+// findClosest returns the index of the closest centroid to the point "p"
+func findClosest(opts *Options, p point, centroids []point) int {
 
 	centLen := len(centroids)
 
 	closestIdx := 0
-	closestDistance := distance(arguments, c, centroids[0])
+	closestDistance := distance(opts, p, centroids[0])
 
 	for i := 1; i < centLen; i++ {
-		distance := distance(arguments, c, centroids[i])
+		distance := distance(opts, p, centroids[i])
 		if distance < closestDistance {
 			closestIdx = i
 			closestDistance = distance
@@ -324,69 +584,40 @@ func findClosest(arguments int, c ColorItem, centroids []ColorItem) int {
 	return closestIdx
 }
 
-// distance returns the distance between two colors
-func distance(arguments int, c ColorItem, p ColorItem) float64 {
-	if IsBitSet(arguments, ArgumentLAB) {
-		return distanceLAB(c, p)
-	}
-	return distanceRGB(c, p)
+// distance returns the distance between two points in the color space in opts
+func distance(opts *Options, c point, p point) float64 {
+	return opts.colorSpace().distance(opts, c.v, p.v)
 }
 
-func distanceLAB(c ColorItem, p ColorItem) float64 {
-	errmsg := "Warning: LAB failed, fallback to RGB"
-
-	a, err := colorful.Hex("#" + c.AsString())
-	if err != nil {
-		log.Fatal(err)
-		log.Println(errmsg)
-		return distanceRGB(c, p)
-	}
-
-	b, err2 := colorful.Hex("#" + p.AsString())
-	if err2 != nil {
-		log.Fatal(err2)
-		log.Println(errmsg)
-		return distanceRGB(c, p)
-	}
-
-	return a.DistanceLab(b)
-}
-
-func distanceRGB(c ColorItem, p ColorItem) float64 {
-	r := c.Color.R
-	g := c.Color.G
-	b := c.Color.B
-
-	r2 := p.Color.R
-	g2 := p.Color.G
-	b2 := p.Color.B
-
-	//sqrt not needed since we just want to compare distances to each other
-	return float64((r-r2)*(r-r2) + (g-g2)*(g-g2) + (b-b2)*(b-b2))
+// squaredDistance returns the squared distance between two points in the color space in opts
+func squaredDistance(opts *Options, c point, p point) float64 {
+	d := distance(opts, c, p)
+	return d * d
 }
 
 // kmeansSeed calculates the initial cluster centroids
-func kmeansSeed(k int, allColors []ColorItem, arguments int) ([]ColorItem, error) {
+func kmeansSeed(k int, allColors []point, opts *Options, rnd *rand.Rand) ([]point, error) {
 	if k > len(allColors) {
 		return nil, fmt.Errorf("Failed, k larger than len(allColors): %d vs %d\n", k, len(allColors))
 	}
 
-	rand.Seed(time.Now().UnixNano())
-
-	if IsBitSet(arguments, ArgumentSeedRandom) {
-		return kmeansSeedRandom(k, allColors), nil
+	switch opts.Init {
+	case InitRandom:
+		return kmeansSeedRandom(k, allColors, rnd), nil
+	case InitWu:
+		return wuQuantize(opts, allColors).centroids, nil
 	}
-	return kmeansPlusPlusSeed(k, arguments, allColors), nil
+	return kmeansPlusPlusSeed(k, opts, allColors, rnd), nil
 }
 
 // kmeansSeedRandom picks k random points as initial centroids
-func kmeansSeedRandom(k int, allColors []ColorItem) []ColorItem {
-	var centroids []ColorItem
+func kmeansSeedRandom(k int, allColors []point, rnd *rand.Rand) []point {
+	var centroids []point
 
 	taken := make(map[int]bool)
 
 	for i := 0; i < k; i++ {
-		idx := rand.Intn(len(allColors))
+		idx := rnd.Intn(len(allColors))
 
 		//check if we already taken this one
 		_, ok := taken[idx]
@@ -401,12 +632,12 @@ func kmeansSeedRandom(k int, allColors []ColorItem) []ColorItem {
 }
 
 // kmeansPlusPlusSeed picks initial centroids using K-Means++
-func kmeansPlusPlusSeed(k int, arguments int, allColors []ColorItem) []ColorItem {
-	var centroids []ColorItem
+func kmeansPlusPlusSeed(k int, opts *Options, allColors []point, rnd *rand.Rand) []point {
+	var centroids []point
 
 	taken := make(map[int]bool)
 
-	initIdx := rand.Intn(len(allColors))
+	initIdx := rnd.Intn(len(allColors))
 	centroids = append(centroids, allColors[initIdx])
 	taken[initIdx] = true
 
@@ -425,7 +656,7 @@ func kmeansPlusPlusSeed(k int, arguments int, allColors []ColorItem) []ColorItem
 
 			minDistanceToCluster := -1.0
 			for i := 0; i < len(centroids); i++ {
-				d := distance(arguments, centroids[i], allColors[j])
+				d := distance(opts, centroids[i], allColors[j])
 				if minDistanceToCluster == -1.0 || d < minDistanceToCluster {
 					minDistanceToCluster = d
 				}
@@ -436,17 +667,28 @@ func kmeansPlusPlusSeed(k int, arguments int, allColors []ColorItem) []ColorItem
 			point2distance = append(point2distance, squareDistance)
 		}
 
-		rndpoint := rand.Float64() * totaldistances
+		// all remaining colors are equal to a centroid, no more centroids to pick
+		if totaldistances == 0.0 {
+			break
+		}
+
+		rndpoint := rnd.Float64() * totaldistances
 
+		// pick the point whose interval [sofar, sofar+distance) contains rndpoint
 		sofar := 0.0
+		picked := -1
 		for j := 0; j < len(point2distance); j++ {
-			if rndpoint <= sofar {
-				centroids = append(centroids, allColors[j])
-				taken[j] = true
-				break
+			if point2distance[j] == 0.0 {
+				continue
 			}
+			picked = j
 			sofar += point2distance[j]
+			if rndpoint < sofar {
+				break
+			}
 		}
+		centroids = append(centroids, allColors[picked])
+		taken[picked] = true
 	}
 
 	return centroids
@@ -0,0 +1,159 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// testImage returns an image with a few blocks of color with some noise, so there are many unique colors
+func testImage() image.Image {
+	rnd := rand.New(rand.NewSource(1))
+	blocks := []color.RGBA{
+		{200, 40, 40, 255},
+		{40, 160, 60, 255},
+		{30, 60, 200, 255},
+		{230, 210, 80, 255},
+		{90, 90, 90, 255},
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 100; x++ {
+			c := blocks[(x/20+y/30)%len(blocks)]
+			noise := func(v uint8) uint8 {
+				n := int(v) + rnd.Intn(31) - 15
+				if n < 0 {
+					return 0
+				}
+				if n > 255 {
+					return 255
+				}
+				return uint8(n)
+			}
+			img.Set(x, y, color.RGBA{noise(c.R), noise(c.G), noise(c.B), 255})
+		}
+	}
+	return img
+}
+
+func TestWithSeedReproducible(t *testing.T) {
+	img := testImage()
+	for _, init := range []InitMethod{InitKmeansPlusPlus, InitRandom} {
+		opts := []Option{WithK(4), WithInit(init), WithCropping(false), WithMasks(nil)}
+
+		first, err := Extract(img, append(opts, WithSeed(42))...)
+		if err != nil {
+			t.Fatalf("init %d: %v", init, err)
+		}
+		for i := 0; i < 3; i++ {
+			again, err := Extract(img, append(opts, WithSeed(42))...)
+			if err != nil {
+				t.Fatalf("init %d: %v", init, err)
+			}
+			if !reflect.DeepEqual(first, again) {
+				t.Errorf("init %d: palette with the same seed differs, %v and %v", init, first, again)
+			}
+		}
+
+		a, err := Extract(img, append(opts, WithRand(rand.New(rand.NewSource(7))))...)
+		if err != nil {
+			t.Fatalf("init %d: %v", init, err)
+		}
+		b, err := Extract(img, append(opts, WithRand(rand.New(rand.NewSource(7))))...)
+		if err != nil {
+			t.Fatalf("init %d: %v", init, err)
+		}
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("init %d: palette with equally seeded random sources differs, %v and %v", init, a, b)
+		}
+	}
+}
+
+// checkColorRange reports colors with channels out of range
+func checkColorRange(t *testing.T, name string, c ColorItem) {
+	t.Helper()
+	if c.Color.R > 0xff || c.Color.G > 0xff || c.Color.B > 0xff {
+		t.Errorf("%s: 8 bit color out of range %v", name, c.Color)
+	}
+	if c.Color16.R > 0xffff || c.Color16.G > 0xffff || c.Color16.B > 0xffff {
+		t.Errorf("%s: 16 bit color out of range %v", name, c.Color16)
+	}
+	if s := c.AsString(); len(s) != 6 {
+		t.Errorf("%s: AsString %q is not 6 characters", name, s)
+	}
+}
+
+func TestCreateColor(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      color.Color
+		want   ColorRGB
+		weight float64
+	}{
+		{"opaque", color.RGBA{200, 100, 50, 255}, ColorRGB{200, 100, 50}, 1.0},
+		{"half transparent", color.NRGBA{200, 100, 50, 128}, ColorRGB{200, 100, 50}, float64(0x8080) / 0xffff},
+		{"nearly transparent", color.NRGBA{255, 255, 255, 1}, ColorRGB{255, 255, 255}, float64(0x101) / 0xffff},
+		// not a valid premultiplied color, as produced by resampling that overshoots at alpha edges
+		{"overshoot", color.RGBA64{R: 0xffff, G: 0x9000, B: 0x10, A: 0x8000}, ColorRGB{255, 255, 0}, float64(0x8000) / 0xffff},
+	}
+	for _, tt := range tests {
+		c, ignore := createColor(tt.c, 0)
+		if ignore {
+			t.Errorf("%s: ignored", tt.name)
+			continue
+		}
+		checkColorRange(t, tt.name, c)
+		if c.Color != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, c.Color, tt.want)
+		}
+		if c.Weight != tt.weight {
+			t.Errorf("%s: got weight %v, want %v", tt.name, c.Weight, tt.weight)
+		}
+	}
+
+	if _, ignore := createColor(color.NRGBA{255, 0, 0, 0}, 0); !ignore {
+		t.Error("transparent color not ignored")
+	}
+	if _, ignore := createColor(color.NRGBA{255, 0, 0, 100}, 0.5); !ignore {
+		t.Error("color below min alpha not ignored")
+	}
+}
+
+func TestSemiTransparentInRange(t *testing.T) {
+	// stripes of white, black and semi-transparent orange ramps, resized so the resampling mixes them
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 40))
+	for x := 0; x < 400; x++ {
+		var c color.NRGBA
+		switch (x / 7) % 3 {
+		case 0:
+			c = color.NRGBA{255, 255, 255, 255}
+		case 1:
+			c = color.NRGBA{0, 0, 0, 255}
+		default:
+			c = color.NRGBA{255, uint8(x % 7 * 35), 0, uint8(x % 7 * 40)}
+		}
+		for y := 0; y < 40; y++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	for _, algorithm := range []Algorithm{AlgorithmKmeans, AlgorithmMedianCut, AlgorithmOctree, AlgorithmWu} {
+		// k is below the number of unique colors, so the quantizer runs
+		centroids, err := Extract(img, WithAlgorithm(algorithm), WithCropping(false), WithMasks(nil), WithK(3), WithSeed(1))
+		if err != nil {
+			t.Fatalf("algorithm %d: %v", algorithm, err)
+		}
+		if len(centroids) == 0 || len(centroids) > 3 {
+			t.Errorf("algorithm %d: got %d centroids", algorithm, len(centroids))
+		}
+		for _, c := range centroids {
+			checkColorRange(t, "centroid", c)
+		}
+	}
+}
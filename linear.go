@@ -0,0 +1,96 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// linearRGBSpace is linear-light RGB, averaging here gives physically correct mixtures of the colors.
+// Distances are still measured with the Metric in Options on the sRGB encoded colors
+type linearRGBSpace struct{}
+
+func (linearRGBSpace) fromColorful(c colorful.Color) [3]float64 {
+	r, g, b := c.LinearRgb()
+	return [3]float64{r, g, b}
+}
+
+func (linearRGBSpace) toColorful(v [3]float64) colorful.Color {
+	return colorful.LinearRgb(v[0], v[1], v[2])
+}
+
+func (s linearRGBSpace) distance(opts *Options, a, b [3]float64) float64 {
+	return opts.Metric.Distance(s.toColorful(a), s.toColorful(b))
+}
+
+func (linearRGBSpace) average(opts *Options, points []point) [3]float64 {
+	return averageChannels(opts.Average, points)
+}
+
+// linear16 returns the channels of the 16 bit sRGB color, converted to linear light (scaled to 0-0xffff) if linear is set.
+// The octree and Wu sum these, so their centroids are averaged in linear light with LinearLight
+func linear16(c ColorRGB, linear bool) [3]float64 {
+	v := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	if linear {
+		r, g, b := colorful.Color{R: v[0] / 0xffff, G: v[1] / 0xffff, B: v[2] / 0xffff}.LinearRgb()
+		v = [3]float64{r * 0xffff, g * 0xffff, b * 0xffff}
+	}
+	return v
+}
+
+// encode16 converts the channels from linear16 back to a 16 bit sRGB color
+func encode16(v [3]float64, linear bool) (r, g, b uint32) {
+	if linear {
+		c := colorful.LinearRgb(v[0]/0xffff, v[1]/0xffff, v[2]/0xffff).Clamped()
+		return to16Bit(c.R), to16Bit(c.G), to16Bit(c.B)
+	}
+	return uint32(v[0] + 0.5), uint32(v[1] + 0.5), uint32(v[2] + 0.5)
+}
+
+// convertImage returns a 16 bit copy of img where f has been applied to the (non premultiplied) r,g,b of each pixel
+func convertImage(img image.Image, f func(c colorful.Color) colorful.Color) *image.RGBA64 {
+	b := img.Bounds()
+	out := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+			// un-premultiply, convert and premultiply again
+			alpha := float64(a) / 65535.0
+			c := f(colorful.Color{
+				R: float64(r) / float64(a),
+				G: float64(g) / float64(a),
+				B: float64(bl) / float64(a),
+			}).Clamped()
+			out.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(c.R*alpha*65535.0 + 0.5),
+				G: uint16(c.G*alpha*65535.0 + 0.5),
+				B: uint16(c.B*alpha*65535.0 + 0.5),
+				A: uint16(a),
+			})
+		}
+	}
+	return out
+}
+
+// linearizeImage converts the sRGB encoded image to linear light
+func linearizeImage(img image.Image) *image.RGBA64 {
+	return convertImage(img, func(c colorful.Color) colorful.Color {
+		r, g, b := c.LinearRgb()
+		return colorful.Color{R: r, G: g, B: b}
+	})
+}
+
+// encodeImage converts the linear light image back to sRGB
+func encodeImage(img image.Image) *image.RGBA64 {
+	return convertImage(img, func(c colorful.Color) colorful.Color {
+		return colorful.LinearRgb(c.R, c.G, c.B)
+	})
+}
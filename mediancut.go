@@ -0,0 +1,102 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import "sort"
+
+// medianCut splits the colors into (at most) k boxes by repeatedly cutting the box with the widest channel range
+// at the pixel weighted median of that channel. It is deterministic and does not iterate.
+func medianCut(opts *Options, allColors []point) *clustering {
+	boxes := [][]point{allColors}
+
+	for len(boxes) < opts.K {
+		// find the box with the widest range in any channel
+		widestBox, splitChannel := -1, 0
+		var widestRange uint32
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			channel, r := widestChannel(box)
+			if widestBox == -1 || r > widestRange {
+				widestBox, splitChannel, widestRange = i, channel, r
+			}
+		}
+
+		// all boxes are single colors, nothing left to split
+		if widestBox == -1 {
+			break
+		}
+
+		low, high := splitBox(boxes[widestBox], splitChannel)
+		boxes[widestBox] = low
+		boxes = append(boxes, high)
+	}
+
+	cl := &clustering{centroids: calculateCentroids(boxes, nil, opts), clusters: boxes, converged: true}
+	cl.sort()
+	return cl
+}
+
+// widestChannel returns the channel (0=r, 1=g, 2=b) with the widest range in the box, and the range
+func widestChannel(box []point) (int, uint32) {
+	min := [3]uint32{0xffff, 0xffff, 0xffff}
+	var max [3]uint32
+	for _, aColor := range box {
+		for c := 0; c < 3; c++ {
+			v := channelValue(aColor.item, c)
+			if v < min[c] {
+				min[c] = v
+			}
+			if v > max[c] {
+				max[c] = v
+			}
+		}
+	}
+
+	channel := 0
+	for c := 1; c < 3; c++ {
+		if max[c]-min[c] > max[channel]-min[channel] {
+			channel = c
+		}
+	}
+	return channel, max[channel] - min[channel]
+}
+
+// splitBox sorts the box on channel and splits it where half of the (alpha weighted) pixels are on each side
+func splitBox(box []point, channel int) ([]point, []point) {
+	sorted := make([]point, len(box))
+	copy(sorted, box)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return channelValue(sorted[i].item, channel) < channelValue(sorted[j].item, channel)
+	})
+
+	total := 0.0
+	for _, aColor := range sorted {
+		total += aColor.item.Weight
+	}
+
+	// both halves must contain at least one color
+	split := 1
+	sofar := sorted[0].item.Weight
+	for split < len(sorted)-1 && sofar*2 < total {
+		sofar += sorted[split].item.Weight
+		split++
+	}
+
+	return sorted[:split], sorted[split:]
+}
+
+// channelValue returns the 16 bit r, g or b of the color
+func channelValue(c ColorItem, channel int) uint32 {
+	c16 := c.rgb16()
+	switch channel {
+	case 0:
+		return c16.R
+	case 1:
+		return c16.G
+	}
+	return c16.B
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Metric measures the distance between two colors, used when assigning colors to clusters and when seeding K-means++
+type Metric interface {
+	// Distance returns the (non-negative) distance between a and b, it must be 0 for equal colors
+	Distance(a, b colorful.Color) float64
+}
+
+// DistanceFunc lets an ordinary function be used as a Metric
+type DistanceFunc func(a, b colorful.Color) float64
+
+// Distance calls f(a, b)
+func (f DistanceFunc) Distance(a, b colorful.Color) float64 {
+	return f(a, b)
+}
+
+var (
+	// MetricEuclideanRGB is the euclidean distance in sRGB (default)
+	MetricEuclideanRGB Metric = DistanceFunc(func(a, b colorful.Color) float64 {
+		return a.DistanceRgb(b)
+	})
+	// MetricRedmean is the euclidean distance in sRGB where the channels are weighted depending on the mean red value,
+	// a cheap approximation of a perceptual distance
+	MetricRedmean Metric = DistanceFunc(distanceRedmean)
+	// MetricCIE76 is the euclidean distance in CIE L*a*b*
+	MetricCIE76 Metric = DistanceFunc(func(a, b colorful.Color) float64 {
+		return a.DistanceCIE76(b)
+	})
+	// MetricCIE94 is the CIE94 distance, more perceptually uniform than CIE76
+	MetricCIE94 Metric = DistanceFunc(func(a, b colorful.Color) float64 {
+		return a.DistanceCIE94(b)
+	})
+	// MetricCIEDE2000 is the CIEDE2000 distance, the most perceptually uniform and the slowest
+	MetricCIEDE2000 Metric = DistanceFunc(func(a, b colorful.Color) float64 {
+		return a.DistanceCIEDE2000(b)
+	})
+)
+
+// distanceRedmean see https://www.compuphase.com/cmetric.htm
+func distanceRedmean(a, b colorful.Color) float64 {
+	rmean := (a.R + b.R) / 2.0
+	dr := a.R - b.R
+	dg := a.G - b.G
+	db := a.B - b.B
+	return math.Sqrt((2.0+rmean)*dr*dr + 4.0*dg*dg + (3.0-rmean)*db*db)
+}
+
+// deltaELab returns the color in Lab with L in [0,100] (go-colorful uses [0,1]), so euclidean distances are
+// CIE76 ΔE, where about 2.3 is just noticeable. All tolerances and radii in ΔE are compared to distances in this scale
+func deltaELab(c colorful.Color) [3]float64 {
+	l, a, b := c.Lab()
+	return [3]float64{l * 100.0, a * 100.0, b * 100.0}
+}
+
+// fromDeltaELab converts the color from deltaELab back to a colorful.Color
+func fromDeltaELab(v [3]float64) colorful.Color {
+	return colorful.Lab(v[0]/100.0, v[1]/100.0, v[2]/100.0)
+}
+
+// toColorful converts the 16 bit color to a colorful.Color
+func (c ColorItem) toColorful() colorful.Color {
+	r, g, b := c.RGBFloat()
+	return colorful.Color{R: r, G: g, B: b}
+}
@@ -0,0 +1,299 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import "image"
+
+// OctreeReduction defines which nodes are merged first when the octree has too many leaves
+type OctreeReduction int
+
+const (
+	// OctreeReduceFewest merges the nodes with the fewest pixels first, keeping detail in the dominant colors (default)
+	OctreeReduceFewest OctreeReduction = iota
+	// OctreeReduceMost merges the nodes with the most pixels first, keeping rare colors apart
+	OctreeReduceMost
+)
+
+// DefaultOctreeMaxDepth is the default depth of the octree, at depth 8 each leaf is a single 8 bit color
+const DefaultOctreeMaxDepth = 8
+
+// octreeNode is a node in the octree, leaves keep the sum of the (16 bit, alpha weighted, see linear16) colors of their pixels
+type octreeNode struct {
+	children [8]*octreeNode
+	leaf     bool
+	r, g, b  float64
+	cnt      int
+	weight   float64
+}
+
+// octree quantizes colors by putting them in a tree where each level splits r,g,b on one more bit
+type octree struct {
+	root      *octreeNode
+	maxDepth  int
+	reduction OctreeReduction
+	// levels contains the inner nodes at each level, the candidates for being merged into leaves
+	levels    [][]*octreeNode
+	numLeaves int
+	// linear sums the colors in linear light
+	linear bool
+}
+
+// octreeQuantize builds an octree from all pixels in the image in one pass and reduces it to k leaves.
+// Merging a node can remove up to 7 leaves at once, so once that would leave fewer than k leaves,
+// the remaining leaves are merged pairwise (the pair that adds the least error first) instead
+func octreeQuantize(opts *Options, img image.Image, allColors []point) *clustering {
+	tree := &octree{
+		root:      &octreeNode{},
+		maxDepth:  opts.OctreeMaxDepth,
+		reduction: opts.OctreeReduction,
+		levels:    make([][]*octreeNode, opts.OctreeMaxDepth),
+		linear:    opts.LinearLight,
+	}
+	tree.levels[0] = []*octreeNode{tree.root}
+
+	wm := newWeightMap(opts, img)
+	data := img.Bounds()
+	for x := data.Min.X; x < data.Max.X; x++ {
+		for y := data.Min.Y; y < data.Max.Y; y++ {
+			colorItem, ignore := pixelColor(img, x, y, opts.MinAlpha, wm)
+			if ignore {
+				continue
+			}
+			tree.insert(colorItem)
+		}
+	}
+
+	for tree.numLeaves > opts.K && tree.reduce(opts.K) {
+	}
+
+	// groups of leaves, each group ends up as one centroid
+	leaves := tree.leaves()
+	group := make(map[*octreeNode]int)
+	sums := make([]*octreeNode, len(leaves))
+	for i, leaf := range leaves {
+		group[leaf] = i
+		sums[i] = &octreeNode{r: leaf.r, g: leaf.g, b: leaf.b, cnt: leaf.cnt, weight: leaf.weight}
+	}
+	mergeClosestLeaves(opts, sums, group)
+
+	// put each unique color in the cluster of the group its leaf ended up in
+	space := opts.colorSpace()
+	groupIdx := make(map[int]int)
+	var centroids []point
+	var clusters [][]point
+	for _, aColor := range allColors {
+		g := group[tree.find(aColor.item.Color)]
+		idx, ok := groupIdx[g]
+		if !ok {
+			idx = len(centroids)
+			groupIdx[g] = idx
+			centroids = append(centroids, toPoint(space, sums[g].colorItem(tree.linear)))
+			clusters = append(clusters, []point{})
+		}
+		clusters[idx] = append(clusters[idx], aColor)
+	}
+
+	cl := &clustering{centroids: centroids, clusters: clusters, converged: true}
+	cl.sort()
+	return cl
+}
+
+// childIndex returns which of the 8 children the color belongs to at level
+func childIndex(c ColorRGB, level int) int {
+	shift := uint(7 - level)
+	idx := 0
+	if c.R>>shift&1 == 1 {
+		idx |= 4
+	}
+	if c.G>>shift&1 == 1 {
+		idx |= 2
+	}
+	if c.B>>shift&1 == 1 {
+		idx |= 1
+	}
+	return idx
+}
+
+// insert adds one pixel to the tree, the tree is built on the 8 bit color while the sums are 16 bit
+func (t *octree) insert(c ColorItem) {
+	node := t.root
+	for level := 0; !node.leaf; level++ {
+		idx := childIndex(c.Color, level)
+		if node.children[idx] == nil {
+			child := &octreeNode{}
+			if level+1 == t.maxDepth {
+				child.leaf = true
+				t.numLeaves++
+			} else {
+				t.levels[level+1] = append(t.levels[level+1], child)
+			}
+			node.children[idx] = child
+		}
+		node = node.children[idx]
+	}
+	v := linear16(c.rgb16(), t.linear)
+	node.r += c.Weight * v[0]
+	node.g += c.Weight * v[1]
+	node.b += c.Weight * v[2]
+	node.cnt++
+	node.weight += c.Weight
+}
+
+// find returns the leaf the color belongs to
+func (t *octree) find(c ColorRGB) *octreeNode {
+	node := t.root
+	for level := 0; !node.leaf; level++ {
+		child := node.children[childIndex(c, level)]
+		if child == nil {
+			// only happens for colors that were never inserted
+			return node
+		}
+		node = child
+	}
+	return node
+}
+
+// reduce merges the children of one node at the deepest level into that node,
+// returns false if nothing could be merged without ending up with less than k leaves
+func (t *octree) reduce(k int) bool {
+	level := len(t.levels) - 1
+	for level >= 0 && len(t.levels[level]) == 0 {
+		level--
+	}
+	if level < 0 {
+		return false
+	}
+
+	nodes := t.levels[level]
+	pick := 0
+	pickCnt := nodes[0].pixelCount()
+	for i := 1; i < len(nodes); i++ {
+		cnt := nodes[i].pixelCount()
+		if (t.reduction == OctreeReduceFewest && cnt < pickCnt) || (t.reduction == OctreeReduceMost && cnt > pickCnt) {
+			pick, pickCnt = i, cnt
+		}
+	}
+	node := nodes[pick]
+
+	numChildren := 0
+	for _, child := range node.children {
+		if child != nil {
+			numChildren++
+		}
+	}
+	if t.numLeaves-numChildren+1 < k {
+		return false
+	}
+
+	t.levels[level] = append(nodes[:pick], nodes[pick+1:]...)
+
+	for i, child := range node.children {
+		if child == nil {
+			continue
+		}
+		node.r += child.r
+		node.g += child.g
+		node.b += child.b
+		node.cnt += child.cnt
+		node.weight += child.weight
+		node.children[i] = nil
+		t.numLeaves--
+	}
+	node.leaf = true
+	t.numLeaves++
+	return true
+}
+
+// leaves returns all leaves in the tree
+func (t *octree) leaves() []*octreeNode {
+	var leaves []*octreeNode
+	nodes := []*octreeNode{t.root}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		if node.leaf {
+			leaves = append(leaves, node)
+			continue
+		}
+		for _, child := range node.children {
+			if child != nil {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	return leaves
+}
+
+// mergeClosestLeaves merges groups pairwise until at most opts.K are left, each time picking the pair whose merge
+// adds the least squared error (w1*w2/(w1+w2) * distance^2 in the color space of opts, w being the alpha weighted number of pixels).
+// Merged groups are nil in sums, and group is updated to point to the group each leaf ended up in
+func mergeClosestLeaves(opts *Options, sums []*octreeNode, group map[*octreeNode]int) {
+	space := opts.colorSpace()
+	points := make([]point, len(sums))
+	for i := range sums {
+		points[i] = toPoint(space, sums[i].colorItem(opts.LinearLight))
+	}
+
+	numGroups := len(sums)
+	for numGroups > opts.K {
+		bestI, bestJ := -1, -1
+		bestCost := 0.0
+		for i := range sums {
+			if sums[i] == nil || sums[i].weight == 0 {
+				continue
+			}
+			for j := i + 1; j < len(sums); j++ {
+				if sums[j] == nil || sums[j].weight == 0 {
+					continue
+				}
+				wi, wj := sums[i].weight, sums[j].weight
+				cost := wi * wj / (wi + wj) * squaredDistance(opts, points[i], points[j])
+				if bestI == -1 || cost < bestCost {
+					bestI, bestJ, bestCost = i, j, cost
+				}
+			}
+		}
+		if bestI == -1 {
+			return
+		}
+
+		sums[bestI].r += sums[bestJ].r
+		sums[bestI].g += sums[bestJ].g
+		sums[bestI].b += sums[bestJ].b
+		sums[bestI].cnt += sums[bestJ].cnt
+		sums[bestI].weight += sums[bestJ].weight
+		sums[bestJ] = nil
+		points[bestI] = toPoint(space, sums[bestI].colorItem(opts.LinearLight))
+		for leaf, g := range group {
+			if g == bestJ {
+				group[leaf] = bestI
+			}
+		}
+		numGroups--
+	}
+}
+
+// pixelCount returns the number of pixels in the node and all nodes below it
+func (n *octreeNode) pixelCount() int {
+	if n.leaf {
+		return n.cnt
+	}
+	cnt := 0
+	for _, child := range n.children {
+		if child != nil {
+			cnt += child.pixelCount()
+		}
+	}
+	return cnt
+}
+
+// colorItem returns the mean color of the pixels in the leaf, linear is set if the sums are in linear light
+func (n *octreeNode) colorItem(linear bool) ColorItem {
+	if n.weight == 0 {
+		return ColorItem{}
+	}
+	r, g, b := encode16([3]float64{n.r / n.weight, n.g / n.weight, n.b / n.weight}, linear)
+	return newColorItem(r, g, b, n.cnt, n.weight)
+}
@@ -0,0 +1,502 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/rand"
+	"time"
+)
+
+// Algorithm defines which algorithm is used to find the prominent colors
+type Algorithm int
+
+const (
+	// AlgorithmKmeans clusters the colors using k-means (default)
+	AlgorithmKmeans Algorithm = iota
+	// AlgorithmMedianCut repeatedly splits the colors at the median of the widest channel, fast and deterministic
+	AlgorithmMedianCut
+	// AlgorithmOctree builds an octree from the pixels in a single pass and merges leaves until K remain
+	AlgorithmOctree
+	// AlgorithmWu uses Wu's quantizer, which repeatedly cuts the box of colors with the largest variance, deterministic
+	AlgorithmWu
+)
+
+// InitMethod defines how the initial k-means centroids are picked
+type InitMethod int
+
+const (
+	// InitKmeansPlusPlus picks initial centroids using K-means++ (default)
+	InitKmeansPlusPlus InitMethod = iota
+	// InitRandom randomly picks initial centroids
+	InitRandom
+	// InitWu uses the colors found by Wu's quantizer as initial centroids, deterministic
+	InitWu
+)
+
+// AverageMethod defines how the color of a centroid is determined from the colors in its cluster
+type AverageMethod int
+
+const (
+	// AverageMedian takes the median value of each channel of the unique colors (default for the Kmeans* functions)
+	AverageMedian AverageMethod = iota
+	// AverageMean takes the mean value of each channel of the unique colors
+	AverageMean
+	// AverageWeightedMedian takes the median value of each channel of all pixels (default for Extract)
+	AverageWeightedMedian
+	// AverageWeightedMean takes the mean value of each channel of all pixels
+	AverageWeightedMean
+)
+
+var (
+	// ErrInvalidK is returned when k is less than 1
+	ErrInvalidK = errors.New("k must be at least 1")
+	// ErrInvalidSize is returned when the size to resize to is 0
+	ErrInvalidSize = errors.New("size must be larger than 0")
+	// ErrInvalidMaxIterations is returned when max iterations is less than 1
+	ErrInvalidMaxIterations = errors.New("max iterations must be at least 1")
+	// ErrInvalidOctreeDepth is returned when the octree max depth is not between 1 and 8
+	ErrInvalidOctreeDepth = errors.New("octree max depth must be between 1 and 8")
+	// ErrInvalidMethod is returned when an unknown algorithm, init or average method, color space, or a nil metric, is given
+	ErrInvalidMethod = errors.New("unknown method")
+	// ErrInvalidMinAlpha is returned when the min alpha is not between 0 and 1
+	ErrInvalidMinAlpha = errors.New("min alpha must be between 0 and 1")
+	// ErrInvalidMask is returned when a ColorBackgroundMask has values out of range
+	ErrInvalidMask = errors.New("mask values out of range")
+	// ErrContradictoryMask is returned when a ColorBackgroundMask sets values that contradict each other
+	ErrContradictoryMask = errors.New("contradictory mask settings")
+)
+
+// OptionError is returned by Extract when the options do not validate.
+// Err is one of the Err* sentinel errors above, use errors.Is to check for them
+type OptionError struct {
+	Option string
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("Failed, invalid option %s: %v", e.Option, e.Err)
+}
+
+// Unwrap returns the underlying sentinel error
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// Options contains all settings used when extracting the prominent colors.
+// Start from DefaultOptions when building it, and pass it to Extract with WithOptions
+type Options struct {
+	// K is the number of colors to find
+	K int
+	// Size is the width the image is re-sized to before processing
+	Size uint
+	// Masks are the background masks to try, see GetDefaultMasks
+	Masks []ColorBackgroundMask
+	// Algorithm is the algorithm used to find the colors
+	Algorithm Algorithm
+	// OctreeMaxDepth is the depth of the octree, 1-8 (octree only)
+	OctreeMaxDepth int
+	// OctreeReduction is which nodes are merged first (octree only)
+	OctreeReduction OctreeReduction
+	// Init is how the initial centroids are picked (k-means only)
+	Init InitMethod
+	// Average is how the color of a centroid is calculated
+	Average AverageMethod
+	// NoCropping disables the cropping
+	NoCropping bool
+	// Crop is the region of the image that is used, see DefaultCrop
+	Crop Crop
+	// CenterWeight makes the pixels count less the further they are from the center (of the cropped image)
+	CenterWeight CenterWeight
+	// SaliencyWeight weighs the pixels by their saliency (edges, color contrast and saturation)
+	SaliencyWeight bool
+	// PixelMask is a gray or alpha mask with the same bounds as the image, pixels where it is 0 are ignored
+	// and partially covered pixels count less
+	PixelMask image.Image
+	// Background defines how it is decided if the image has a background that matches one of the Masks
+	Background BackgroundDetection
+	// AutoBackground estimates the background color from the border instead of using Masks
+	AutoBackground AutoBackground
+	// FloodFill defines how the background is removed once a mask matched
+	FloodFill FloodFill
+	// BackgroundRemover removes the background instead of Masks, Background, AutoBackground and FloodFill, nil for the default
+	BackgroundRemover BackgroundRemover
+	// PixelFilter is called for each pixel (of the cropped region) in the original image, pixels it returns false for are ignored
+	PixelFilter PixelFilter
+	// MaxIterations is the max number of k-means rounds, a safety net in case it does not converge
+	MaxIterations int
+	// Space is the color space the colors are clustered in
+	Space ColorSpace
+	// Metric measures the distance between colors when clustering in SpaceRGB
+	Metric Metric
+	// LinearLight linearizes the pixels before resizing, and before averaging the centroids in SpaceRGB
+	LinearLight bool
+	// MinAlpha is the alpha (0-1) below which pixels are ignored, fully transparent pixels are always ignored.
+	// Semi-transparent pixels above it are un-premultiplied and weighted by their alpha
+	MinAlpha float64
+	// Seed seeds the random source used when picking initial centroids, 0 means seeded from the clock
+	Seed int64
+	// Rand is used when picking initial centroids instead of a source created from Seed.
+	// A *rand.Rand is not safe for concurrent use, so do not share it between concurrent calls
+	Rand *rand.Rand
+	// DebugImage saves a tmp file in /tmp/ where the area that has been cut away by the mask is marked pink
+	DebugImage bool
+}
+
+// Option modifies the Options used by Extract
+type Option func(*Options)
+
+// DefaultOptions returns the options used when Extract is called without any Option
+func DefaultOptions() Options {
+	return Options{
+		K:              DefaultK,
+		Size:           DefaultSize,
+		Masks:          GetDefaultMasks(),
+		MaxIterations:  DefaultMaxIterations,
+		OctreeMaxDepth: DefaultOctreeMaxDepth,
+		Average:        AverageWeightedMedian,
+		Metric:         MetricEuclideanRGB,
+		Crop:           DefaultCrop,
+	}
+}
+
+// WithOptions replaces all options with o, Option funcs after it modify o
+func WithOptions(o Options) Option {
+	return func(opts *Options) {
+		*opts = o
+	}
+}
+
+// WithK sets the number of colors to find
+func WithK(k int) Option {
+	return func(o *Options) {
+		o.K = k
+	}
+}
+
+// WithSize sets the width the image is re-sized to
+func WithSize(size uint) Option {
+	return func(o *Options) {
+		o.Size = size
+	}
+}
+
+// WithMasks sets the background masks to use, nil or empty disables masking
+func WithMasks(bgmasks []ColorBackgroundMask) Option {
+	return func(o *Options) {
+		o.Masks = bgmasks
+	}
+}
+
+// WithAlgorithm sets the algorithm used to find the colors
+func WithAlgorithm(algorithm Algorithm) Option {
+	return func(o *Options) {
+		o.Algorithm = algorithm
+	}
+}
+
+// WithOctree sets the max depth of the octree and which nodes are merged first
+func WithOctree(maxDepth int, reduction OctreeReduction) Option {
+	return func(o *Options) {
+		o.OctreeMaxDepth = maxDepth
+		o.OctreeReduction = reduction
+	}
+}
+
+// WithInit sets how the initial centroids are picked
+func WithInit(method InitMethod) Option {
+	return func(o *Options) {
+		o.Init = method
+	}
+}
+
+// WithAverage sets how the color of a centroid is calculated
+func WithAverage(method AverageMethod) Option {
+	return func(o *Options) {
+		o.Average = method
+	}
+}
+
+// WithCropping enables or disables the cropping
+func WithCropping(enabled bool) Option {
+	return func(o *Options) {
+		o.NoCropping = !enabled
+	}
+}
+
+// WithCrop sets the region of the image that is used (and enables cropping)
+func WithCrop(crop Crop) Option {
+	return func(o *Options) {
+		o.Crop = crop
+		o.NoCropping = false
+	}
+}
+
+// WithCropSides removes the fractions (0-1) of the image from each side
+func WithCropSides(left, top, right, bottom float64) Option {
+	return WithCrop(Crop{Mode: CropSides, Left: left, Top: top, Right: right, Bottom: bottom})
+}
+
+// WithCropRect only uses the region r of the image, Extract fails with ErrInvalidCrop if r does not overlap the image
+func WithCropRect(r image.Rectangle) Option {
+	return WithCrop(Crop{Mode: CropRect, Rect: r})
+}
+
+// WithCropWindow uses a window of width x height (fractions of the image) placed at anchor
+func WithCropWindow(width, height float64, anchor CropAnchor) Option {
+	return WithCrop(Crop{Mode: CropWindow, Width: width, Height: height, Anchor: anchor})
+}
+
+// WithCropAspect uses the largest window with the aspect ratio (width/height), scaled by scale, placed at anchor
+func WithCropAspect(aspectRatio, scale float64, anchor CropAnchor) Option {
+	return WithCrop(Crop{Mode: CropAspect, AspectRatio: aspectRatio, Scale: scale, Anchor: anchor})
+}
+
+// WithCenterWeight weighs the pixels with falloff depending on their distance from the center, instead of the default crop.
+// A crop set with WithCrop (or one of the WithCrop* options) is still applied, and the pixels of the cropped image are weighed
+func WithCenterWeight(falloff Falloff, sigma float64) Option {
+	return func(o *Options) {
+		o.CenterWeight = CenterWeight{Falloff: falloff, Sigma: sigma}
+	}
+}
+
+// WithSaliencyWeight enables or disables weighing the pixels by their saliency
+func WithSaliencyWeight(enabled bool) Option {
+	return func(o *Options) {
+		o.SaliencyWeight = enabled
+	}
+}
+
+// WithSmartCrop uses the window of width x height (fractions of the image) with the highest saliency
+func WithSmartCrop(width, height float64) Option {
+	return WithCrop(Crop{Mode: CropSalient, Width: width, Height: height})
+}
+
+// WithBorderDetection applies a mask if at least minMatch (0-1] of the border pixels match it, instead of all four corners.
+// The background is then removed starting from all matching border pixels
+func WithBorderDetection(minMatch float64) Option {
+	return func(o *Options) {
+		o.Background = BackgroundDetection{Mode: DetectBorder, MinBorderMatch: minMatch}
+	}
+}
+
+// WithAutoBackground estimates the background color from the border, and removes the pixels within tolerance
+// (CIE76 ΔE) of it if at least minConfidence (0-1) of the border is. Masks are not used
+func WithAutoBackground(tolerance, minConfidence float64) Option {
+	return func(o *Options) {
+		o.AutoBackground = AutoBackground{Tolerance: tolerance, MinConfidence: minConfidence}
+	}
+}
+
+// WithGradientBackground is WithAutoBackground for backgrounds with a gradient or vignette: the model (ModelPlanar or
+// ModelRadial) is fitted to the border, and the pixels within tolerance (CIE76 ΔE) of it at their position are removed
+func WithGradientBackground(model BackgroundModel, tolerance, minConfidence float64) Option {
+	return func(o *Options) {
+		o.AutoBackground = AutoBackground{Tolerance: tolerance, MinConfidence: minConfidence, Model: model}
+	}
+}
+
+// WithFloodFill removes the background pixels within tolerance (CIE76 ΔE) from the background color,
+// optionally following diagonal neighbours and removing holes of at most maxHoleSize pixels
+func WithFloodFill(tolerance float64, eightConnected bool, maxHoleSize int) Option {
+	return func(o *Options) {
+		o.FloodFill = FloodFill{Tolerance: tolerance, EightConnected: eightConnected, MaxHoleSize: maxHoleSize}
+	}
+}
+
+// WithPixelMask only uses the pixels covered by mask, a gray or alpha image with the same bounds as the image
+func WithPixelMask(mask image.Image) Option {
+	return func(o *Options) {
+		o.PixelMask = mask
+	}
+}
+
+// WithPixelFilter only uses the pixels that filter returns true for
+func WithPixelFilter(filter PixelFilter) Option {
+	return func(o *Options) {
+		o.PixelFilter = filter
+	}
+}
+
+// WithBackgroundRemover removes the background with remover, e.g. a MaskRemover with a precomputed mask,
+// instead of the built in mask matching and flood fill
+func WithBackgroundRemover(remover BackgroundRemover) Option {
+	return func(o *Options) {
+		o.BackgroundRemover = remover
+	}
+}
+
+// WithMinAlpha sets the alpha (0-1) below which pixels are ignored
+func WithMinAlpha(minAlpha float64) Option {
+	return func(o *Options) {
+		o.MinAlpha = minAlpha
+	}
+}
+
+// WithMaxIterations sets the max number of k-means rounds
+func WithMaxIterations(maxIterations int) Option {
+	return func(o *Options) {
+		o.MaxIterations = maxIterations
+	}
+}
+
+// WithSpace sets the color space the colors are clustered in
+func WithSpace(space ColorSpace) Option {
+	return func(o *Options) {
+		o.Space = space
+	}
+}
+
+// WithLinearLight enables or disables resizing and averaging in linear light (gamma correct)
+func WithLinearLight(enabled bool) Option {
+	return func(o *Options) {
+		o.LinearLight = enabled
+	}
+}
+
+// WithMetric sets how the distance between colors is measured
+func WithMetric(metric Metric) Option {
+	return func(o *Options) {
+		o.Metric = metric
+	}
+}
+
+// WithLAB clusters in SpaceLab if enabled, otherwise in SpaceRGB, the same as ArgumentLAB. The metric is not changed
+func WithLAB(enabled bool) Option {
+	return func(o *Options) {
+		o.Space = SpaceRGB
+		if enabled {
+			o.Space = SpaceLab
+		}
+	}
+}
+
+// WithSeed makes the result reproducible by seeding the random source with seed
+func WithSeed(seed int64) Option {
+	return func(o *Options) {
+		o.Seed = seed
+	}
+}
+
+// WithRand sets the random source to use when picking initial centroids
+func WithRand(rnd *rand.Rand) Option {
+	return func(o *Options) {
+		o.Rand = rnd
+	}
+}
+
+// WithDebugImage enables or disables saving the masked image in /tmp/
+func WithDebugImage(enabled bool) Option {
+	return func(o *Options) {
+		o.DebugImage = enabled
+	}
+}
+
+// WithArguments applies the bits of the Argument* constants.
+// As for the Kmeans* functions, the centroid color is the (unweighted) median or mean of the unique colors
+func WithArguments(arguments int) Option {
+	return func(o *Options) {
+		if IsBitSet(arguments, ArgumentSeedRandom) {
+			o.Init = InitRandom
+		}
+		o.Average = AverageMedian
+		if IsBitSet(arguments, ArgumentAverageMean) {
+			o.Average = AverageMean
+		}
+		if IsBitSet(arguments, ArgumentNoCropping) {
+			o.NoCropping = true
+		}
+		if IsBitSet(arguments, ArgumentLAB) {
+			o.Space = SpaceLab
+		}
+		if IsBitSet(arguments, ArgumentDebugImage) {
+			o.DebugImage = true
+		}
+	}
+}
+
+// Validate checks that the options are usable, it returns an *OptionError if not
+func (o *Options) Validate() error {
+	if o.K < 1 {
+		return &OptionError{Option: "K", Err: ErrInvalidK}
+	}
+	if o.Size == 0 {
+		return &OptionError{Option: "Size", Err: ErrInvalidSize}
+	}
+	if o.MaxIterations < 1 {
+		return &OptionError{Option: "MaxIterations", Err: ErrInvalidMaxIterations}
+	}
+	if o.Algorithm < AlgorithmKmeans || o.Algorithm > AlgorithmWu {
+		return &OptionError{Option: "Algorithm", Err: ErrInvalidMethod}
+	}
+	if o.OctreeMaxDepth < 1 || o.OctreeMaxDepth > 8 {
+		return &OptionError{Option: "OctreeMaxDepth", Err: ErrInvalidOctreeDepth}
+	}
+	if o.OctreeReduction != OctreeReduceFewest && o.OctreeReduction != OctreeReduceMost {
+		return &OptionError{Option: "OctreeReduction", Err: ErrInvalidMethod}
+	}
+	if o.Init < InitKmeansPlusPlus || o.Init > InitWu {
+		return &OptionError{Option: "Init", Err: ErrInvalidMethod}
+	}
+	if o.Average < AverageMedian || o.Average > AverageWeightedMean {
+		return &OptionError{Option: "Average", Err: ErrInvalidMethod}
+	}
+	if o.Space < SpaceRGB || o.Space > SpaceHSL {
+		return &OptionError{Option: "Space", Err: ErrInvalidMethod}
+	}
+	if o.Metric == nil {
+		return &OptionError{Option: "Metric", Err: ErrInvalidMethod}
+	}
+	if err := o.Crop.validate(); err != nil {
+		return &OptionError{Option: "Crop", Err: err}
+	}
+	if err := o.Background.validate(); err != nil {
+		return &OptionError{Option: "Background", Err: err}
+	}
+	if err := o.AutoBackground.validate(); err != nil {
+		return &OptionError{Option: "AutoBackground", Err: err}
+	}
+	if err := o.FloodFill.validate(); err != nil {
+		return &OptionError{Option: "FloodFill", Err: err}
+	}
+	if err := o.CenterWeight.validate(); err != nil {
+		return &OptionError{Option: "CenterWeight", Err: err}
+	}
+	if o.MinAlpha < 0 || o.MinAlpha > 1 {
+		return &OptionError{Option: "MinAlpha", Err: ErrInvalidMinAlpha}
+	}
+	for i, bgmask := range o.Masks {
+		if err := bgmask.validate(); err != nil {
+			return &OptionError{Option: fmt.Sprintf("Masks[%d]", i), Err: err}
+		}
+	}
+	return nil
+}
+
+// newRand returns the random source to use for one call, the global math/rand source is never used
+func (o *Options) newRand() *rand.Rand {
+	if o.Rand != nil {
+		return o.Rand
+	}
+	seed := o.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// newOptions applies opts on top of the default options and validates the result
+func newOptions(opts []Option) (*Options, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
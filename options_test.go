@@ -0,0 +1,110 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    Option
+		option string
+		err    error
+	}{
+		{"k", WithK(0), "K", ErrInvalidK},
+		{"size", WithSize(0), "Size", ErrInvalidSize},
+		{"max iterations", WithMaxIterations(0), "MaxIterations", ErrInvalidMaxIterations},
+		{"algorithm", WithAlgorithm(Algorithm(99)), "Algorithm", ErrInvalidMethod},
+		{"octree depth", WithOctree(9, OctreeReduceFewest), "OctreeMaxDepth", ErrInvalidOctreeDepth},
+		{"init", WithInit(InitMethod(99)), "Init", ErrInvalidMethod},
+		{"average", WithAverage(AverageMethod(99)), "Average", ErrInvalidMethod},
+		{"space", WithSpace(ColorSpace(99)), "Space", ErrInvalidMethod},
+		{"metric", WithMetric(nil), "Metric", ErrInvalidMethod},
+		{"crop", WithCropSides(0.5, 0, 0.5, 0), "Crop", ErrInvalidCrop},
+		{"border match", WithBorderDetection(0), "Background", ErrInvalidBorderMatch},
+		{"auto background", WithAutoBackground(-1, 0.5), "AutoBackground", ErrInvalidAutoBackground},
+		{"flood fill", WithFloodFill(-1, false, 0), "FloodFill", ErrInvalidFloodFill},
+		{"center weight", WithCenterWeight(FalloffGaussian, 0), "CenterWeight", ErrInvalidSigma},
+		{"min alpha", WithMinAlpha(2), "MinAlpha", ErrInvalidMinAlpha},
+		{"mask", WithMasks([]ColorBackgroundMask{{Treshold: 0x10000}}), "Masks[0]", ErrInvalidMask},
+		{"contradictory mask", WithMasks([]ColorBackgroundMask{{R: true, PercDiff: 0.5, Treshold: 1}}), "Masks[0]", ErrContradictoryMask},
+	}
+
+	img := testImage()
+	for _, tt := range tests {
+		o := DefaultOptions()
+		tt.opt(&o)
+		err := o.Validate()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		var optErr *OptionError
+		if !errors.As(err, &optErr) || optErr.Option != tt.option {
+			t.Errorf("%s: got %v, want an *OptionError for %s", tt.name, err, tt.option)
+		}
+
+		if _, err := Extract(img, tt.opt); !errors.Is(err, tt.err) {
+			t.Errorf("%s: Extract returned %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	o := DefaultOptions()
+	if err := o.Validate(); err != nil {
+		t.Errorf("default options: %v", err)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	img := testImage()
+	tests := []struct {
+		name string
+		opts []Option
+		err  error
+	}{
+		{"crop outside the image", []Option{WithCropRect(image.Rect(100000, 100000, 100010, 100010))}, ErrInvalidCrop},
+		{"mask bounds", []Option{WithPixelMask(image.NewGray(image.Rect(0, 0, 1, 1)))}, ErrMaskBounds},
+		{"nil mask remover", []Option{WithBackgroundRemover(MaskRemover{})}, ErrNilMask},
+	}
+	for _, tt := range tests {
+		if _, err := Extract(img, tt.opts...); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	if _, err := AutoK(img, 3, 2, CriterionSilhouette); !errors.Is(err, ErrInvalidKRange) {
+		t.Errorf("k range: got %v, want %v", err, ErrInvalidKRange)
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	img := testImage()
+	o := DefaultOptions()
+	o.K = 4
+	o.Seed = 3
+	o.Masks = nil
+
+	got, err := Extract(img, WithK(2), WithOptions(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Extract(img, WithK(4), WithSeed(3), WithMasks(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	o.K = 0
+	if _, err := Extract(img, WithOptions(o)); !errors.Is(err, ErrInvalidK) {
+		t.Errorf("got %v, want %v", err, ErrInvalidK)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image/color"
+)
+
+// MaskKind defines how a ColorBackgroundMask matches a pixel
+type MaskKind int
+
+const (
+	// MaskChannels compares the r,g,b channels to Treshold or each other (PercDiff), as MaskWhite, MaskBlack and MaskGreen (default)
+	MaskChannels MaskKind = iota
+	// MaskDeltaE matches the colors within Radius (CIE76 ΔE) of Center
+	MaskDeltaE
+	// MaskHSV matches the colors within the HSV range
+	MaskHSV
+)
+
+// HSVRange is a range of colors in HSV. Hue is in degrees [0,360], when HueMin is larger than HueMax the range
+// wraps around 0 (e.g. 340 to 20 for red). Saturation and value are in [0,1].
+// The hue of grays is 0, so to match grays regardless of hue use 0 to 360
+type HSVRange struct {
+	HueMin, HueMax float64
+	SatMin, SatMax float64
+	ValMin, ValMax float64
+}
+
+// NewDeltaEMask returns a mask matching the colors within radius (CIE76 ΔE) of center,
+// e.g. an off-white or a chroma key color
+func NewDeltaEMask(center color.Color, radius float64) ColorBackgroundMask {
+	c, _ := createColor(center, 0)
+	return ColorBackgroundMask{Kind: MaskDeltaE, Center: c.Color, Radius: radius}
+}
+
+// NewHSVMask returns a mask matching the colors within the HSV range
+func NewHSVMask(hsv HSVRange) ColorBackgroundMask {
+	return ColorBackgroundMask{Kind: MaskHSV, HSV: hsv}
+}
+
+// validatePerceptual checks a MaskDeltaE or MaskHSV mask, the channel fields must not be set
+func (bgmask ColorBackgroundMask) validatePerceptual() error {
+	if bgmask.R || bgmask.G || bgmask.B || bgmask.Treshold != 0 || bgmask.PercDiff != 0 {
+		return ErrContradictoryMask
+	}
+
+	switch bgmask.Kind {
+	case MaskDeltaE:
+		if bgmask.HSV != (HSVRange{}) {
+			return ErrContradictoryMask
+		}
+		if bgmask.Radius <= 0 || bgmask.Center.R > 0xff || bgmask.Center.G > 0xff || bgmask.Center.B > 0xff {
+			return ErrInvalidMask
+		}
+		return nil
+	case MaskHSV:
+		if bgmask.Radius != 0 || bgmask.Center != (ColorRGB{}) {
+			return ErrContradictoryMask
+		}
+		return bgmask.HSV.validate()
+	}
+	return ErrInvalidMethod
+}
+
+// validate checks that the hues are in [0,360] and the saturation and value ranges are in [0,1] and not empty
+func (h HSVRange) validate() error {
+	if h.HueMin < 0 || h.HueMin > 360 || h.HueMax < 0 || h.HueMax > 360 {
+		return ErrInvalidMask
+	}
+	if h.SatMin < 0 || h.SatMax > 1 || h.SatMin > h.SatMax {
+		return ErrInvalidMask
+	}
+	if h.ValMin < 0 || h.ValMax > 1 || h.ValMin > h.ValMax {
+		return ErrInvalidMask
+	}
+	return nil
+}
+
+// contains returns true if the color is within the range
+func (h HSVRange) contains(hue, sat, val float64) bool {
+	if sat < h.SatMin || sat > h.SatMax || val < h.ValMin || val > h.ValMax {
+		return false
+	}
+	if h.HueMin <= h.HueMax {
+		return hue >= h.HueMin && hue <= h.HueMax
+	}
+	// wraps around 0
+	return hue >= h.HueMin || hue <= h.HueMax
+}
+
+// matchPerceptual returns true if the (un-premultiplied) color matches a MaskDeltaE or MaskHSV mask
+func (bgmask ColorBackgroundMask) matchPerceptual(c color.Color) bool {
+	colorItem, _ := createColor(c, 0)
+	cf := colorItem.toColorful()
+
+	switch bgmask.Kind {
+	case MaskDeltaE:
+		center := ColorItem{Color: bgmask.Center}
+		return euclidean(deltaELab(cf), deltaELab(center.toColorful())) <= bgmask.Radius
+	case MaskHSV:
+		return bgmask.HSV.contains(cf.Hsv())
+	}
+	return false
+}
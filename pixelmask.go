@@ -0,0 +1,65 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ErrMaskBounds is returned when the PixelMask does not have the same bounds as the image
+var ErrMaskBounds = errors.New("mask must have the same bounds as the image")
+
+// PixelFilter decides per pixel, in the coordinates of the original image, if it is used (true) or ignored (false)
+type PixelFilter func(x, y int, c color.Color) bool
+
+// hasPixelMask returns true if a PixelMask or PixelFilter is set
+func (o *Options) hasPixelMask() bool {
+	return o.PixelMask != nil || o.PixelFilter != nil
+}
+
+// checkPixelMask checks that the PixelMask is aligned with the image
+func (o *Options) checkPixelMask(img image.Image) error {
+	if o.PixelMask != nil && o.PixelMask.Bounds() != img.Bounds() {
+		return &OptionError{Option: "PixelMask", Err: ErrMaskBounds}
+	}
+	return nil
+}
+
+// applyPixelMask returns the region r of img where the alpha of each pixel is multiplied by the coverage of PixelMask
+// and pixels rejected by PixelFilter are transparent, so they are ignored (or count less) when counting colors
+func applyPixelMask(opts *Options, img image.Image, r image.Rectangle) *image.RGBA64 {
+	out := image.NewRGBA64(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.At(x, y)
+			if opts.PixelFilter != nil && !opts.PixelFilter(x, y, c) {
+				continue
+			}
+
+			coverage := uint16(0xffff)
+			if opts.PixelMask != nil {
+				coverage = maskCoverage(opts.PixelMask, x, y)
+			}
+			out.SetRGBA64(x, y, scaleCoverage(c, coverage))
+		}
+	}
+	return out
+}
+
+// maskCoverage returns how much (0-0xffff) the mask covers the pixel,
+// for gray masks this is the gray value, for alpha masks the alpha
+func maskCoverage(mask image.Image, x, y int) uint16 {
+	return color.Gray16Model.Convert(mask.At(x, y)).(color.Gray16).Y
+}
+
+// scaleCoverage returns c with the alpha multiplied by coverage (0-0xffff)
+func scaleCoverage(c color.Color, coverage uint16) color.RGBA64 {
+	cr, cg, cb, ca := c.RGBA()
+	cov := uint32(coverage)
+	// the colors are premultiplied, so all channels are scaled
+	return color.RGBA64{R: uint16(cr * cov / 0xffff), G: uint16(cg * cov / 0xffff), B: uint16(cb * cov / 0xffff), A: uint16(ca * cov / 0xffff)}
+}
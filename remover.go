@@ -0,0 +1,133 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+var (
+	// ErrRemoverBounds is returned when a BackgroundRemover does not return an image with the same bounds as its input
+	ErrRemoverBounds = errors.New("background remover must return an image with the same bounds as the input")
+	// ErrNilMask is returned by MaskRemover when Mask is nil
+	ErrNilMask = errors.New("mask must not be nil")
+)
+
+// BackgroundInfo describes what a BackgroundRemover removed, it ends up in the Result
+type BackgroundInfo struct {
+	// PixelsMasked is the number of pixels that were made transparent
+	PixelsMasked int
+	// Mask is the background mask that was applied, nil if none
+	Mask *ColorBackgroundMask
+	// BorderMatch is the fraction of the border pixels that matched the background
+	BorderMatch float64
+	// Color is the estimated background color, nil if not estimated
+	Color *ColorItem
+	// Confidence is the confidence (0-1) in Color
+	Confidence float64
+}
+
+// BackgroundRemover removes the background of the (cropped and resized) image before the colors are counted.
+// RemoveBackground returns an image with the same bounds where the background is transparent, partly transparent
+// pixels count less. The input image must not be modified
+type BackgroundRemover interface {
+	RemoveBackground(img image.Image) (draw.Image, BackgroundInfo, error)
+}
+
+// BackgroundRemoverFunc is a function used as a BackgroundRemover
+type BackgroundRemoverFunc func(img image.Image) (draw.Image, BackgroundInfo, error)
+
+// RemoveBackground calls f(img)
+func (f BackgroundRemoverFunc) RemoveBackground(img image.Image) (draw.Image, BackgroundInfo, error) {
+	return f(img)
+}
+
+// NewDefaultRemover returns the BackgroundRemover used when none is set: the Masks matched at the corners
+// (or border, see Background) and flood filled, or the estimated background with AutoBackground,
+// configured by the same options as Analyze. It can be wrapped by a BackgroundRemover that falls back to it
+func NewDefaultRemover(opts ...Option) (BackgroundRemover, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &defaultRemover{opts: o}, nil
+}
+
+// defaultRemover is the built in background removal of processImg
+type defaultRemover struct {
+	opts *Options
+}
+
+// RemoveBackground removes the background as configured by the options
+func (d *defaultRemover) RemoveBackground(img image.Image) (draw.Image, BackgroundInfo, error) {
+	imgDraw, bg := processImg(d.opts, img)
+	return imgDraw, bg.info(), nil
+}
+
+// info returns the outcome as BackgroundInfo
+func (bg background) info() BackgroundInfo {
+	return BackgroundInfo{
+		PixelsMasked: bg.numMasked,
+		Mask:         bg.mask,
+		BorderMatch:  bg.borderMatch,
+		Color:        bg.color,
+		Confidence:   bg.confidence,
+	}
+}
+
+// MaskRemover is a BackgroundRemover using a precomputed mask, e.g. from a segmentation model.
+// Mask is a gray or alpha image, 0 is background, and is scaled to the image it is applied to,
+// so it must cover the same region as the image after cropping (or use WithCropping(false))
+type MaskRemover struct {
+	Mask image.Image
+}
+
+// RemoveBackground multiplies the alpha of each pixel with the coverage of the mask,
+// PixelsMasked is the number of pixels whose alpha was lowered
+func (m MaskRemover) RemoveBackground(img image.Image) (draw.Image, BackgroundInfo, error) {
+	var info BackgroundInfo
+	if m.Mask == nil {
+		return nil, info, ErrNilMask
+	}
+	r := img.Bounds()
+	mr := m.Mask.Bounds()
+	out := image.NewRGBA64(r)
+	if r.Empty() || mr.Empty() {
+		return out, info, nil
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		my := mr.Min.Y + (y-r.Min.Y)*mr.Dy()/r.Dy()
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mx := mr.Min.X + (x-r.Min.X)*mr.Dx()/r.Dx()
+			c := img.At(x, y)
+			scaled := scaleCoverage(c, maskCoverage(m.Mask, mx, my))
+			if _, _, _, a := c.RGBA(); uint32(scaled.A) != a {
+				info.PixelsMasked++
+			}
+			out.SetRGBA64(x, y, scaled)
+		}
+	}
+	return out, info, nil
+}
+
+// removeBackground runs the BackgroundRemover in opts, or the default one
+func removeBackground(opts *Options, img image.Image) (draw.Image, BackgroundInfo, error) {
+	var remover BackgroundRemover = &defaultRemover{opts: opts}
+	if opts.BackgroundRemover != nil {
+		remover = opts.BackgroundRemover
+	}
+
+	imgDraw, info, err := remover.RemoveBackground(img)
+	if err != nil {
+		return nil, info, err
+	}
+	if imgDraw == nil || imgDraw.Bounds() != img.Bounds() {
+		return nil, info, ErrRemoverBounds
+	}
+	return imgDraw, info, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import "time"
+
+// Timings contains the time spent in each stage of the pipeline
+type Timings struct {
+	Crop    time.Duration
+	Resize  time.Duration
+	Mask    time.Duration
+	Cluster time.Duration
+}
+
+// Result contains the centroids found by Analyze together with diagnostics
+type Result struct {
+	// Centroids sorted according to dominance (most frequent first)
+	Centroids []ColorItem
+	// Shares contains, for each centroid, the fraction of PixelsConsidered that belongs to it
+	// (weighted by alpha, so semi-transparent pixels count less)
+	Shares []float64
+
+	// PixelsTotal is the number of pixels in the image after cropping and resizing
+	PixelsTotal int
+	// PixelsConsidered is the number of pixels that were clustered (not transparent and not masked out)
+	PixelsConsidered int
+	// PixelsMasked is the number of pixels removed by the background mask
+	PixelsMasked int
+
+	// Iterations is the number of k-means rounds that were run
+	Iterations int
+	// Converged is false if k-means was stopped by MaxIterations before the centroids were stable
+	Converged bool
+	// Inertia is the sum of squared distances from each pixel to its centroid
+	Inertia float64
+
+	// Mask is the background mask that was applied, nil if none of the masks matched
+	Mask *ColorBackgroundMask
+	// BorderMatch is the fraction of the border pixels that matched Mask,
+	// or the best matching mask if none was applied
+	BorderMatch float64
+	// BackgroundColor is the estimated background color with AutoBackground, nil otherwise.
+	// With a gradient model it is the background color at the center of the image
+	BackgroundColor *ColorItem
+	// BackgroundConfidence is the fraction of the border pixels within the tolerance of BackgroundColor
+	BackgroundConfidence float64
+
+	Timings Timings
+}
+
+// calculateShares sets Shares from the Weight of each centroid
+func (r *Result) calculateShares() {
+	r.Shares = make([]float64, len(r.Centroids))
+	total := 0.0
+	for _, c := range r.Centroids {
+		total += c.Weight
+	}
+	if total == 0 {
+		return
+	}
+	for i, c := range r.Centroids {
+		r.Shares[i] = c.Weight / total
+	}
+}
+
+// setClustering copies the outcome of the clustering into the result
+func (r *Result) setClustering(opts *Options, cl *clustering) {
+	r.Centroids = cl.items()
+	r.Iterations = cl.iterations
+	r.Converged = cl.converged
+	r.Inertia = cl.inertia(opts)
+	r.calculateShares()
+}
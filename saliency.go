@@ -0,0 +1,203 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// saliencySize is the width the image is resized to before finding the most salient window
+const saliencySize = 64
+
+// saliency returns a map with the saliency (0-1) of each pixel in img, the mean of
+//   - edge density, the gradient of the lightness averaged over the neighbourhood,
+//   - color contrast, the distance in Lab from the mean color of the image,
+//   - saturation, the chroma on the HSV cone (s*v, so dark noisy pixels do not count as saturated),
+//
+// each normalized to 0-1. Transparent pixels have no saliency. If nothing stands out, all pixels get saliency 1
+func saliency(img image.Image) *weightMap {
+	b := img.Bounds()
+	n := b.Dx() * b.Dy()
+	wm := &weightMap{rect: b, w: make([]float64, n)}
+	if n == 0 {
+		return wm
+	}
+
+	lab := make([][3]float64, n)
+	sat := make([]float64, n)
+	opaque := make([]bool, n)
+	var meanLab [3]float64
+	numOpaque := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := wm.index(x, y)
+			colorItem, ignore := createColor(img.At(x, y), 0)
+			if ignore {
+				continue
+			}
+			c := colorItem.toColorful()
+			l, a, bb := c.Lab()
+			lab[i] = [3]float64{l, a, bb}
+			_, s, v := c.Hsv()
+			sat[i] = s * v
+			opaque[i] = true
+			for j := 0; j < 3; j++ {
+				meanLab[j] += lab[i][j]
+			}
+			numOpaque++
+		}
+	}
+	if numOpaque == 0 {
+		return wm
+	}
+	for j := 0; j < 3; j++ {
+		meanLab[j] /= float64(numOpaque)
+	}
+
+	// gradient of the lightness (sobel), transparent pixels count as the pixel in the middle
+	edges := make([]float64, n)
+	lAt := func(x, y, i int) float64 {
+		x = clampInt(x, b.Min.X, b.Max.X-1)
+		y = clampInt(y, b.Min.Y, b.Max.Y-1)
+		if j := wm.index(x, y); opaque[j] {
+			return lab[j][0]
+		}
+		return lab[i][0]
+	}
+	contrast := make([]float64, n)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := wm.index(x, y)
+			if !opaque[i] {
+				continue
+			}
+			gx := lAt(x+1, y-1, i) + 2*lAt(x+1, y, i) + lAt(x+1, y+1, i) - lAt(x-1, y-1, i) - 2*lAt(x-1, y, i) - lAt(x-1, y+1, i)
+			gy := lAt(x-1, y+1, i) + 2*lAt(x, y+1, i) + lAt(x+1, y+1, i) - lAt(x-1, y-1, i) - 2*lAt(x, y-1, i) - lAt(x+1, y-1, i)
+			edges[i] = math.Sqrt(gx*gx + gy*gy)
+			contrast[i] = euclidean(lab[i], meanLab)
+		}
+	}
+
+	// edge density is the mean gradient in the neighbourhood
+	radius := b.Dx() / 32
+	if radius < 1 {
+		radius = 1
+	}
+	edges = boxBlur(edges, b.Dx(), b.Dy(), radius)
+
+	normalize(edges)
+	normalize(contrast)
+	normalize(sat)
+
+	for i := range wm.w {
+		if opaque[i] {
+			wm.w[i] = (edges[i] + contrast[i] + sat[i]) / 3.0
+		}
+	}
+	if !normalize(wm.w) {
+		for i := range wm.w {
+			if opaque[i] {
+				wm.w[i] = 1.0
+			}
+		}
+	}
+	return wm
+}
+
+// normalize scales the values so the largest is 1, returns false if all values are 0
+func normalize(values []float64) bool {
+	max := 0.0
+	for _, v := range values {
+		max = math.Max(max, v)
+	}
+	if max == 0.0 {
+		return false
+	}
+	for i := range values {
+		values[i] /= max
+	}
+	return true
+}
+
+// boxBlur returns the mean of the values in the (2*radius+1)^2 box around each value, the box is cut at the borders
+func boxBlur(values []float64, w, h, radius int) []float64 {
+	sums := newIntegral(values, w, h)
+	out := make([]float64, len(values))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			x0, y0 := clampInt(x-radius, 0, w), clampInt(y-radius, 0, h)
+			x1, y1 := clampInt(x+radius+1, 0, w), clampInt(y+radius+1, 0, h)
+			out[y*w+x] = sums.sum(x0, y0, x1, y1) / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return out
+}
+
+// integral is a summed-area table, the sum of any rectangle is found in constant time
+type integral struct {
+	w   int
+	sat []float64
+}
+
+// newIntegral builds the summed-area table of the w x h values
+func newIntegral(values []float64, w, h int) *integral {
+	in := &integral{w: w + 1, sat: make([]float64, (w+1)*(h+1))}
+	for y := 0; y < h; y++ {
+		row := 0.0
+		for x := 0; x < w; x++ {
+			row += values[y*w+x]
+			in.sat[(y+1)*in.w+x+1] = in.sat[y*in.w+x+1] + row
+		}
+	}
+	return in
+}
+
+// sum returns the sum of the values in [x0,x1) x [y0,y1)
+func (in *integral) sum(x0, y0, x1, y1 int) float64 {
+	return in.sat[y1*in.w+x1] - in.sat[y0*in.w+x1] - in.sat[y1*in.w+x0] + in.sat[y0*in.w+x0]
+}
+
+// salientWindow returns the window of width x height (fractions of the image) with the highest total saliency.
+// The saliency is calculated on a smaller copy of the image, when windows are equally salient the most central is picked
+func salientWindow(img image.Image, width, height float64) image.Rectangle {
+	b := img.Bounds()
+	small := img
+	if b.Dx() > saliencySize {
+		small = resize.Resize(saliencySize, 0, img, resize.Bilinear)
+	}
+	sb := small.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	wm := saliency(small)
+	sums := newIntegral(wm.w, sw, sh)
+
+	ww, wh := int(math.Round(width*float64(sw))), int(math.Round(height*float64(sh)))
+	ww, wh = clampInt(ww, 1, sw), clampInt(wh, 1, sh)
+
+	bestX, bestY := 0, 0
+	best, bestDist := -1.0, 0.0
+	for y := 0; y+wh <= sh; y++ {
+		for x := 0; x+ww <= sw; x++ {
+			s := sums.sum(x, y, x+ww, y+wh)
+			dx, dy := float64(2*x+ww-sw), float64(2*y+wh-sh)
+			dist := dx*dx + dy*dy
+			if s > best || (s == best && dist < bestDist) {
+				best, bestDist, bestX, bestY = s, dist, x, y
+			}
+		}
+	}
+
+	// scale back to the original image
+	scaleX, scaleY := float64(b.Dx())/float64(sw), float64(b.Dy())/float64(sh)
+	return image.Rect(
+		b.Min.X+int(float64(bestX)*scaleX),
+		b.Min.Y+int(float64(bestY)*scaleY),
+		b.Min.X+int(float64(bestX+ww)*scaleX),
+		b.Min.Y+int(float64(bestY+wh)*scaleY),
+	)
+}
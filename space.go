@@ -0,0 +1,222 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// ColorSpace defines in which color space the colors are clustered, i.e. where distances are measured and centroids averaged
+type ColorSpace int
+
+const (
+	// SpaceRGB clusters in sRGB, distances are measured with the Metric in Options (default)
+	SpaceRGB ColorSpace = iota
+	// SpaceLab clusters in CIE L*a*b*, distances are euclidean in Lab (CIE76)
+	SpaceLab
+	// SpaceOKLab clusters in OKLab, distances are euclidean in OKLab, which is more uniform than Lab (e.g. for blues)
+	SpaceOKLab
+	// SpaceHSV clusters in HSV, the hue is averaged with a circular mean
+	SpaceHSV
+	// SpaceHSL clusters in HSL, the hue is averaged with a circular mean
+	SpaceHSL
+)
+
+// point is a unique color together with its coordinates in the color space used for clustering.
+// The pixels are converted once, and only converted back to sRGB for the centroids
+type point struct {
+	item ColorItem
+	v    [3]float64
+}
+
+// colorSpace converts colors to and from coordinates in a color space, and measures distances there
+type colorSpace interface {
+	fromColorful(c colorful.Color) [3]float64
+	toColorful(v [3]float64) colorful.Color
+	distance(opts *Options, a, b [3]float64) float64
+	// average calculates the centroid of the points according to opts.Average
+	average(opts *Options, points []point) [3]float64
+}
+
+// colorSpace returns the implementation of opts.Space
+func (o *Options) colorSpace() colorSpace {
+	switch o.Space {
+	case SpaceLab:
+		return labSpace{}
+	case SpaceOKLab:
+		return okLabSpace{}
+	case SpaceHSV:
+		return hueSpace{}
+	case SpaceHSL:
+		return hueSpace{hsl: true}
+	}
+	if o.LinearLight {
+		return linearRGBSpace{}
+	}
+	return rgbSpace{}
+}
+
+// toPoint converts the color to a point in the space
+func toPoint(space colorSpace, c ColorItem) point {
+	return point{item: c, v: space.fromColorful(c.toColorful())}
+}
+
+// toPoints converts all colors to points in the space
+func toPoints(space colorSpace, allColors []ColorItem) []point {
+	points := make([]point, len(allColors))
+	for i, aColor := range allColors {
+		points[i] = toPoint(space, aColor)
+	}
+	return points
+}
+
+// toCentroid converts coordinates in the space back to a 16 bit color with cnt pixels
+func toCentroid(space colorSpace, v [3]float64, cnt int, weight float64) point {
+	c := space.toColorful(v).Clamped()
+	return point{item: newColorItem(to16Bit(c.R), to16Bit(c.G), to16Bit(c.B), cnt, weight), v: v}
+}
+
+// to16Bit rounds the value in [0,1] to 16 bits
+func to16Bit(v float64) uint32 {
+	return uint32(v*0xffff + 0.5)
+}
+
+// euclidean returns the euclidean distance between the coordinates
+func euclidean(a, b [3]float64) float64 {
+	d0 := a[0] - b[0]
+	d1 := a[1] - b[1]
+	d2 := a[2] - b[2]
+	return math.Sqrt(d0*d0 + d1*d1 + d2*d2)
+}
+
+// rgbSpace is sRGB with channels in [0,1]
+type rgbSpace struct{}
+
+func (rgbSpace) fromColorful(c colorful.Color) [3]float64 {
+	return [3]float64{c.R, c.G, c.B}
+}
+
+func (rgbSpace) toColorful(v [3]float64) colorful.Color {
+	return colorful.Color{R: v[0], G: v[1], B: v[2]}
+}
+
+func (s rgbSpace) distance(opts *Options, a, b [3]float64) float64 {
+	return opts.Metric.Distance(s.toColorful(a), s.toColorful(b))
+}
+
+func (rgbSpace) average(opts *Options, points []point) [3]float64 {
+	return averageChannels(opts.Average, points)
+}
+
+// labSpace is CIE L*a*b* (D65), as used by colorful
+type labSpace struct{}
+
+func (labSpace) fromColorful(c colorful.Color) [3]float64 {
+	l, a, b := c.Lab()
+	return [3]float64{l, a, b}
+}
+
+func (labSpace) toColorful(v [3]float64) colorful.Color {
+	return colorful.Lab(v[0], v[1], v[2])
+}
+
+func (labSpace) distance(opts *Options, a, b [3]float64) float64 {
+	return euclidean(a, b)
+}
+
+func (labSpace) average(opts *Options, points []point) [3]float64 {
+	return averageChannels(opts.Average, points)
+}
+
+// okLabSpace is OKLab, see https://bottosson.github.io/posts/oklab/
+type okLabSpace struct{}
+
+func (okLabSpace) fromColorful(c colorful.Color) [3]float64 {
+	l, a, b := c.OkLab()
+	return [3]float64{l, a, b}
+}
+
+func (okLabSpace) toColorful(v [3]float64) colorful.Color {
+	return colorful.OkLab(v[0], v[1], v[2])
+}
+
+func (okLabSpace) distance(opts *Options, a, b [3]float64) float64 {
+	return euclidean(a, b)
+}
+
+func (okLabSpace) average(opts *Options, points []point) [3]float64 {
+	return averageChannels(opts.Average, points)
+}
+
+// hueSpace is HSV, or HSL if hsl is set, with the hue in degrees [0,360) and saturation and value/lightness in [0,1]
+type hueSpace struct {
+	hsl bool
+}
+
+func (s hueSpace) fromColorful(c colorful.Color) [3]float64 {
+	if s.hsl {
+		h, sat, l := c.Hsl()
+		return [3]float64{h, sat, l}
+	}
+	h, sat, v := c.Hsv()
+	return [3]float64{h, sat, v}
+}
+
+func (s hueSpace) toColorful(v [3]float64) colorful.Color {
+	if s.hsl {
+		return colorful.Hsl(v[0], v[1], v[2])
+	}
+	return colorful.Hsv(v[0], v[1], v[2])
+}
+
+// distance is euclidean after placing the colors on a cone (HSV) or double cone (HSL), where the hue is the angle.
+// This handles the wraparound at 0/360, and makes the hue matter less the closer the color is to grey,
+// where the hue is unstable (and meaningless for pure greys)
+func (s hueSpace) distance(opts *Options, a, b [3]float64) float64 {
+	return euclidean(s.cone(a), s.cone(b))
+}
+
+// cone returns the coordinates on the (double) cone
+func (s hueSpace) cone(v [3]float64) [3]float64 {
+	radius := v[1] * v[2]
+	if s.hsl {
+		radius = v[1] * (1.0 - math.Abs(2.0*v[2]-1.0))
+	}
+	rad := v[0] * math.Pi / 180.0
+	return [3]float64{radius * math.Cos(rad), radius * math.Sin(rad), v[2]}
+}
+
+// average uses a circular mean for the hue, and opts.Average for saturation and value/lightness
+func (s hueSpace) average(opts *Options, points []point) [3]float64 {
+	v := averageChannels(opts.Average, points)
+	weighted := opts.Average == AverageWeightedMean || opts.Average == AverageWeightedMedian
+	v[0] = circularMeanHue(points, weighted)
+	return v
+}
+
+// circularMeanHue returns the mean angle of the hues, where each hue is weighted by its saturation
+// (so greys, with unstable hues, count less), and by the (alpha weighted) number of pixels if weighted is set
+func circularMeanHue(points []point, weighted bool) float64 {
+	x, y := 0.0, 0.0
+	for _, aPoint := range points {
+		w := aPoint.v[1]
+		if weighted {
+			w *= aPoint.item.Weight
+		}
+		rad := aPoint.v[0] * math.Pi / 180.0
+		x += w * math.Cos(rad)
+		y += w * math.Sin(rad)
+	}
+	if x == 0.0 && y == 0.0 {
+		return 0.0
+	}
+	h := math.Atan2(y, x) * 180.0 / math.Pi
+	if h < 0.0 {
+		h += 360.0
+	}
+	return h
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"math"
+	"testing"
+)
+
+// hueDiff returns the distance in degrees between two hues, taking the wraparound at 0/360 into account
+func hueDiff(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360.0)
+	return math.Min(d, 360.0-d)
+}
+
+func TestCircularMeanHue(t *testing.T) {
+	hue := func(h, s, v float64) point {
+		return point{item: ColorItem{Cnt: 1, Weight: 1.0}, v: [3]float64{h, s, v}}
+	}
+	tests := []struct {
+		name   string
+		points []point
+		want   float64
+	}{
+		{"across 0", []point{hue(350, 0.8, 0.9), hue(10, 0.8, 0.9)}, 0.0},
+		{"grey does not pull", []point{hue(350, 0.8, 0.9), hue(10, 0.8, 0.9), hue(180, 0.0, 0.5)}, 0.0},
+		{"saturation weighted", []point{hue(340, 0.8, 0.9), hue(20, 0.4, 0.9)}, 353.1},
+		{"not across 0", []point{hue(100, 0.5, 0.5), hue(140, 0.5, 0.5)}, 120.0},
+	}
+	for _, tt := range tests {
+		for _, weighted := range []bool{false, true} {
+			if got := circularMeanHue(tt.points, weighted); hueDiff(got, tt.want) > 0.1 {
+				t.Errorf("%s (weighted %v): got %v, want %v", tt.name, weighted, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHueSpaceDistance(t *testing.T) {
+	opts := DefaultOptions()
+	for _, space := range []hueSpace{{}, {hsl: true}} {
+		lightness := 1.0
+		if space.hsl {
+			lightness = 0.5
+		}
+		near := space.distance(&opts, [3]float64{359, 1, lightness}, [3]float64{1, 1, lightness})
+		far := space.distance(&opts, [3]float64{359, 1, lightness}, [3]float64{179, 1, lightness})
+		if near > 0.05 {
+			t.Errorf("hsl %v: distance between 359 and 1 degrees is %v, want close to 0", space.hsl, near)
+		}
+		if far < 1.9 {
+			t.Errorf("hsl %v: distance between 359 and 179 degrees is %v, want close to 2", space.hsl, far)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// Falloff defines how the weight of a pixel decreases with its distance from the center of the image
+type Falloff int
+
+const (
+	// FalloffNone gives all pixels the same weight (default)
+	FalloffNone Falloff = iota
+	// FalloffGaussian weighs the pixels with a gaussian, exp(-d²/(2σ²))
+	FalloffGaussian
+	// FalloffRadial decreases the weight linearly, 1-d/σ, pixels further away than σ are ignored
+	FalloffRadial
+)
+
+// ErrInvalidSigma is returned when the sigma of a falloff is not larger than 0
+var ErrInvalidSigma = errors.New("sigma must be larger than 0")
+
+// CenterWeight weighs the pixels depending on their distance d from the center of the image, where d is
+// normalized so that it is 1 at the middle of each side (0.5 is half way between the center and the sides)
+type CenterWeight struct {
+	Falloff Falloff
+	Sigma   float64
+}
+
+// validate checks that the falloff is known and sigma is usable
+func (c CenterWeight) validate() error {
+	if c.Falloff < FalloffNone || c.Falloff > FalloffRadial {
+		return ErrInvalidMethod
+	}
+	if c.Falloff != FalloffNone && c.Sigma <= 0 {
+		return ErrInvalidSigma
+	}
+	return nil
+}
+
+// weight returns the weight of a pixel at the normalized distance d from the center
+func (c CenterWeight) weight(d float64) float64 {
+	switch c.Falloff {
+	case FalloffGaussian:
+		return math.Exp(-d * d / (2.0 * c.Sigma * c.Sigma))
+	case FalloffRadial:
+		return math.Max(0.0, 1.0-d/c.Sigma)
+	}
+	return 1.0
+}
+
+// weightMap contains a weight for each pixel in rect, multiplied with the alpha when counting colors
+type weightMap struct {
+	rect image.Rectangle
+	w    []float64
+}
+
+// newWeightMap returns the weights of the pixels in img according to opts (center weight times saliency),
+// nil if all pixels weigh the same
+func newWeightMap(opts *Options, img image.Image) *weightMap {
+	wm := newCenterWeightMap(opts, img)
+	if !opts.SaliencyWeight {
+		return wm
+	}
+
+	sm := saliency(img)
+	if wm != nil {
+		for i := range sm.w {
+			sm.w[i] *= wm.w[i]
+		}
+	}
+	return sm
+}
+
+// newCenterWeightMap returns the weights of the pixels in img according to opts.CenterWeight, nil if there is no falloff
+func newCenterWeightMap(opts *Options, img image.Image) *weightMap {
+	if opts.CenterWeight.Falloff == FalloffNone {
+		return nil
+	}
+
+	b := img.Bounds()
+	wm := &weightMap{rect: b, w: make([]float64, b.Dx()*b.Dy())}
+	halfW, halfH := float64(b.Dx())/2.0, float64(b.Dy())/2.0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// distance from the center of the pixel to the center of the image
+			dx := (float64(x-b.Min.X) + 0.5 - halfW) / halfW
+			dy := (float64(y-b.Min.Y) + 0.5 - halfH) / halfH
+			wm.w[wm.index(x, y)] = opts.CenterWeight.weight(math.Sqrt(dx*dx + dy*dy))
+		}
+	}
+	return wm
+}
+
+// index returns the index of the pixel in w
+func (wm *weightMap) index(x, y int) int {
+	return (y-wm.rect.Min.Y)*wm.rect.Dx() + (x - wm.rect.Min.X)
+}
+
+// at returns the weight of the pixel, 1 if wm is nil
+func (wm *weightMap) at(x, y int) float64 {
+	if wm == nil {
+		return 1.0
+	}
+	return wm.w[wm.index(x, y)]
+}
+
+// pixelColor returns the color of the pixel with its weight (alpha times the weight in wm),
+// ignore is set for transparent pixels and pixels without weight
+func pixelColor(img image.Image, x, y int, minAlpha float64, wm *weightMap) (ColorItem, bool) {
+	colorItem, ignore := createColor(img.At(x, y), minAlpha)
+	if ignore {
+		return colorItem, true
+	}
+	colorItem.Weight *= wm.at(x, y)
+	return colorItem, colorItem.Weight == 0
+}
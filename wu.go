@@ -0,0 +1,303 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+// Wu's color quantizer, see Xiaolin Wu, "Efficient Statistical Computations for Optimal Color Quantization",
+// Graphics Gems II. The colors are put in a 32x32x32 histogram (5 bits per channel) of cumulative moments,
+// and the box with the largest variance is repeatedly cut in two where it reduces the variance the most.
+
+// wuSide is the number of histogram cells per channel, plus one for the cumulative moments
+const wuSide = 33
+
+const (
+	wuRed = iota
+	wuGreen
+	wuBlue
+)
+
+// wuBox is a box in the histogram, lower bounds are exclusive and upper bounds inclusive
+type wuBox struct {
+	r0, r1, g0, g1, b0, b1 int
+	vol                    int
+}
+
+// wuMoments contains the cumulative moments of the histogram
+type wuMoments struct {
+	wt, mr, mg, mb, m2 []float64
+}
+
+// wuIndex returns the index in the moment arrays
+func wuIndex(r, g, b int) int {
+	return r*wuSide*wuSide + g*wuSide + b
+}
+
+// wuQuantize splits the colors into (at most) k boxes, it is deterministic and does not iterate
+func wuQuantize(opts *Options, allColors []point) *clustering {
+	m := newWuMoments(allColors, opts.LinearLight)
+
+	cubes := make([]wuBox, opts.K)
+	vv := make([]float64, opts.K)
+	cubes[0] = wuBox{r1: wuSide - 1, g1: wuSide - 1, b1: wuSide - 1}
+
+	numCubes := opts.K
+	next := 0
+	for i := 1; i < numCubes; i++ {
+		if m.cut(&cubes[next], &cubes[i]) {
+			vv[next], vv[i] = 0.0, 0.0
+			if cubes[next].vol > 1 {
+				vv[next] = m.variance(&cubes[next])
+			}
+			if cubes[i].vol > 1 {
+				vv[i] = m.variance(&cubes[i])
+			}
+		} else {
+			// the box could not be cut, do not try it again
+			vv[next] = 0.0
+			i--
+		}
+
+		next = 0
+		temp := vv[0]
+		for j := 1; j <= i; j++ {
+			if vv[j] > temp {
+				temp = vv[j]
+				next = j
+			}
+		}
+		if temp <= 0.0 {
+			numCubes = i + 1
+			break
+		}
+	}
+	cubes = cubes[:numCubes]
+
+	// put each unique color in the cluster of the box it is in
+	clusters := make([][]point, numCubes)
+	counts := make([]int, numCubes)
+	for _, aColor := range allColors {
+		r, g, b := int(aColor.item.Color.R>>3)+1, int(aColor.item.Color.G>>3)+1, int(aColor.item.Color.B>>3)+1
+		for i := range cubes {
+			c := &cubes[i]
+			if r > c.r0 && r <= c.r1 && g > c.g0 && g <= c.g1 && b > c.b0 && b <= c.b1 {
+				clusters[i] = append(clusters[i], aColor)
+				counts[i] += aColor.item.Cnt
+				break
+			}
+		}
+	}
+
+	space := opts.colorSpace()
+	var centroids []point
+	var nonEmpty [][]point
+	for i := range cubes {
+		weight := m.volume(&cubes[i], m.wt)
+		if weight == 0 || len(clusters[i]) == 0 {
+			continue
+		}
+		r, g, b := encode16([3]float64{
+			m.volume(&cubes[i], m.mr) / weight,
+			m.volume(&cubes[i], m.mg) / weight,
+			m.volume(&cubes[i], m.mb) / weight,
+		}, opts.LinearLight)
+		centroids = append(centroids, toPoint(space, newColorItem(r, g, b, counts[i], weight)))
+		nonEmpty = append(nonEmpty, clusters[i])
+	}
+
+	cl := &clustering{centroids: centroids, clusters: nonEmpty, converged: true}
+	cl.sort()
+	return cl
+}
+
+// newWuMoments builds the histogram of the colors (indexed by the 8 bit color, with 16 bit moments, in linear light if linear is set)
+// and turns it into cumulative moments
+func newWuMoments(allColors []point, linear bool) *wuMoments {
+	size := wuSide * wuSide * wuSide
+	m := &wuMoments{
+		wt: make([]float64, size),
+		mr: make([]float64, size),
+		mg: make([]float64, size),
+		mb: make([]float64, size),
+		m2: make([]float64, size),
+	}
+
+	for _, aPoint := range allColors {
+		aColor := aPoint.item
+		v := linear16(aColor.rgb16(), linear)
+		r, g, b := v[0], v[1], v[2]
+		cnt := aColor.Weight
+		idx := wuIndex(int(aColor.Color.R>>3)+1, int(aColor.Color.G>>3)+1, int(aColor.Color.B>>3)+1)
+		m.wt[idx] += cnt
+		m.mr[idx] += cnt * r
+		m.mg[idx] += cnt * g
+		m.mb[idx] += cnt * b
+		m.m2[idx] += cnt * (r*r + g*g + b*b)
+	}
+
+	for r := 1; r < wuSide; r++ {
+		var area, areaR, areaG, areaB, area2 [wuSide]float64
+		for g := 1; g < wuSide; g++ {
+			line, lineR, lineG, lineB, line2 := 0.0, 0.0, 0.0, 0.0, 0.0
+			for b := 1; b < wuSide; b++ {
+				ind1 := wuIndex(r, g, b)
+				line += m.wt[ind1]
+				lineR += m.mr[ind1]
+				lineG += m.mg[ind1]
+				lineB += m.mb[ind1]
+				line2 += m.m2[ind1]
+
+				area[b] += line
+				areaR[b] += lineR
+				areaG[b] += lineG
+				areaB[b] += lineB
+				area2[b] += line2
+
+				ind2 := wuIndex(r-1, g, b)
+				m.wt[ind1] = m.wt[ind2] + area[b]
+				m.mr[ind1] = m.mr[ind2] + areaR[b]
+				m.mg[ind1] = m.mg[ind2] + areaG[b]
+				m.mb[ind1] = m.mb[ind2] + areaB[b]
+				m.m2[ind1] = m.m2[ind2] + area2[b]
+			}
+		}
+	}
+	return m
+}
+
+// volume returns the sum of the moment over the box
+func (m *wuMoments) volume(c *wuBox, mom []float64) float64 {
+	return mom[wuIndex(c.r1, c.g1, c.b1)] -
+		mom[wuIndex(c.r1, c.g1, c.b0)] -
+		mom[wuIndex(c.r1, c.g0, c.b1)] +
+		mom[wuIndex(c.r1, c.g0, c.b0)] -
+		mom[wuIndex(c.r0, c.g1, c.b1)] +
+		mom[wuIndex(c.r0, c.g1, c.b0)] +
+		mom[wuIndex(c.r0, c.g0, c.b1)] -
+		mom[wuIndex(c.r0, c.g0, c.b0)]
+}
+
+// bottom returns the part of volume that does not depend on the position of the cut in dir
+func (m *wuMoments) bottom(c *wuBox, dir int, mom []float64) float64 {
+	switch dir {
+	case wuRed:
+		return -mom[wuIndex(c.r0, c.g1, c.b1)] +
+			mom[wuIndex(c.r0, c.g1, c.b0)] +
+			mom[wuIndex(c.r0, c.g0, c.b1)] -
+			mom[wuIndex(c.r0, c.g0, c.b0)]
+	case wuGreen:
+		return -mom[wuIndex(c.r1, c.g0, c.b1)] +
+			mom[wuIndex(c.r1, c.g0, c.b0)] +
+			mom[wuIndex(c.r0, c.g0, c.b1)] -
+			mom[wuIndex(c.r0, c.g0, c.b0)]
+	}
+	return -mom[wuIndex(c.r1, c.g1, c.b0)] +
+		mom[wuIndex(c.r1, c.g0, c.b0)] +
+		mom[wuIndex(c.r0, c.g1, c.b0)] -
+		mom[wuIndex(c.r0, c.g0, c.b0)]
+}
+
+// top returns the part of volume that depends on the position pos of the cut in dir
+func (m *wuMoments) top(c *wuBox, dir int, pos int, mom []float64) float64 {
+	switch dir {
+	case wuRed:
+		return mom[wuIndex(pos, c.g1, c.b1)] -
+			mom[wuIndex(pos, c.g1, c.b0)] -
+			mom[wuIndex(pos, c.g0, c.b1)] +
+			mom[wuIndex(pos, c.g0, c.b0)]
+	case wuGreen:
+		return mom[wuIndex(c.r1, pos, c.b1)] -
+			mom[wuIndex(c.r1, pos, c.b0)] -
+			mom[wuIndex(c.r0, pos, c.b1)] +
+			mom[wuIndex(c.r0, pos, c.b0)]
+	}
+	return mom[wuIndex(c.r1, c.g1, pos)] -
+		mom[wuIndex(c.r1, c.g0, pos)] -
+		mom[wuIndex(c.r0, c.g1, pos)] +
+		mom[wuIndex(c.r0, c.g0, pos)]
+}
+
+// variance returns the weighted variance of the box
+func (m *wuMoments) variance(c *wuBox) float64 {
+	dr := m.volume(c, m.mr)
+	dg := m.volume(c, m.mg)
+	db := m.volume(c, m.mb)
+	xx := m.volume(c, m.m2)
+	weight := m.volume(c, m.wt)
+	if weight == 0 {
+		return 0.0
+	}
+	return xx - (dr*dr+dg*dg+db*db)/weight
+}
+
+// maximize finds the cut in dir between first and last that maximizes the reduction in variance,
+// the returned cut is -1 if no cut is possible
+func (m *wuMoments) maximize(c *wuBox, dir int, first, last int, wholeR, wholeG, wholeB, wholeW float64) (float64, int) {
+	baseR := m.bottom(c, dir, m.mr)
+	baseG := m.bottom(c, dir, m.mg)
+	baseB := m.bottom(c, dir, m.mb)
+	baseW := m.bottom(c, dir, m.wt)
+
+	max := 0.0
+	cut := -1
+	for i := first; i < last; i++ {
+		halfR := baseR + m.top(c, dir, i, m.mr)
+		halfG := baseG + m.top(c, dir, i, m.mg)
+		halfB := baseB + m.top(c, dir, i, m.mb)
+		halfW := baseW + m.top(c, dir, i, m.wt)
+
+		// both halves must contain pixels
+		if halfW == 0 {
+			continue
+		}
+		temp := (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+
+		halfR = wholeR - halfR
+		halfG = wholeG - halfG
+		halfB = wholeB - halfB
+		halfW = wholeW - halfW
+		if halfW == 0 {
+			continue
+		}
+		temp += (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+
+		if temp > max {
+			max = temp
+			cut = i
+		}
+	}
+	return max, cut
+}
+
+// cut splits set1 in two, set1 keeps the lower half and set2 gets the upper half. Returns false if it could not be cut
+func (m *wuMoments) cut(set1, set2 *wuBox) bool {
+	wholeR := m.volume(set1, m.mr)
+	wholeG := m.volume(set1, m.mg)
+	wholeB := m.volume(set1, m.mb)
+	wholeW := m.volume(set1, m.wt)
+
+	maxR, cutR := m.maximize(set1, wuRed, set1.r0+1, set1.r1, wholeR, wholeG, wholeB, wholeW)
+	maxG, cutG := m.maximize(set1, wuGreen, set1.g0+1, set1.g1, wholeR, wholeG, wholeB, wholeW)
+	maxB, cutB := m.maximize(set1, wuBlue, set1.b0+1, set1.b1, wholeR, wholeG, wholeB, wholeW)
+
+	set2.r1, set2.g1, set2.b1 = set1.r1, set1.g1, set1.b1
+
+	switch {
+	case maxR >= maxG && maxR >= maxB:
+		if cutR < 0 {
+			return false
+		}
+		set1.r1 = cutR
+		set2.r0, set2.g0, set2.b0 = cutR, set1.g0, set1.b0
+	case maxG >= maxR && maxG >= maxB:
+		set1.g1 = cutG
+		set2.r0, set2.g0, set2.b0 = set1.r0, cutG, set1.b0
+	default:
+		set1.b1 = cutB
+		set2.r0, set2.g0, set2.b0 = set1.r0, set1.g0, cutB
+	}
+
+	set1.vol = (set1.r1 - set1.r0) * (set1.g1 - set1.g0) * (set1.b1 - set1.b0)
+	set2.vol = (set2.r1 - set2.r0) * (set2.g1 - set2.g0) * (set2.b1 - set2.b0)
+	return true
+}
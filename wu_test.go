@@ -0,0 +1,73 @@
+// Copyright 2016 Carl Asman. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prominentcolor
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestWuDeterministic(t *testing.T) {
+	img := testImage()
+	for _, opt := range []Option{WithAlgorithm(AlgorithmWu), WithInit(InitWu)} {
+		for k := 1; k <= 8; k++ {
+			opts := []Option{opt, WithK(k), WithCropping(false), WithMasks(nil)}
+			first, err := Extract(img, opts...)
+			if err != nil {
+				t.Fatalf("k %d: %v", k, err)
+			}
+			if len(first) == 0 || len(first) > k {
+				t.Errorf("k %d: got %d centroids", k, len(first))
+			}
+			again, err := Extract(img, opts...)
+			if err != nil {
+				t.Fatalf("k %d: %v", k, err)
+			}
+			if !reflect.DeepEqual(first, again) {
+				t.Errorf("k %d: palette differs between calls, %v and %v", k, first, again)
+			}
+		}
+	}
+}
+
+func TestWuFewColors(t *testing.T) {
+	// more unique colors than k, but they fall in only 3 cells of the 5 bit histogram,
+	// so Wu runs out of boxes that can be cut before it has k boxes
+	bases := []color.RGBA{{200, 40, 40, 255}, {40, 40, 200, 255}, {40, 200, 40, 255}}
+	img := image.NewRGBA(image.Rect(0, 0, 12, 10))
+	for x := 0; x < 12; x++ {
+		c := bases[x/4]
+		// the low 3 bits are not used by the histogram
+		d := uint8(x % 4)
+		for y := 0; y < 10; y++ {
+			img.Set(x, y, color.RGBA{c.R + d, c.G + d, c.B + d, 255})
+		}
+	}
+
+	res, err := Analyze(img, WithAlgorithm(AlgorithmWu), WithK(8), WithCropping(false), WithMasks(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Centroids) != len(bases) {
+		t.Fatalf("got %d centroids, want %d: %v", len(res.Centroids), len(bases), res.Centroids)
+	}
+	cnt := 0
+	seen := make(map[ColorRGB]bool)
+	for _, c := range res.Centroids {
+		if c.Cnt != 40 {
+			t.Errorf("centroid %s has %d pixels, want 40", c.AsString(), c.Cnt)
+		}
+		if seen[c.Color16] {
+			t.Errorf("centroid %s is duplicated", c.AsString())
+		}
+		seen[c.Color16] = true
+		cnt += c.Cnt
+	}
+	if cnt != res.PixelsTotal {
+		t.Errorf("centroids have %d pixels, want %d", cnt, res.PixelsTotal)
+	}
+}